@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/drone/drone-exec/docker"
+	"github.com/drone/drone-exec/runner"
+	"github.com/drone/drone-exec/yaml"
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/samalba/dockerclient"
+)
+
+const (
+	// DefaultDir is the default host directory in which
+	// cache archives are stored.
+	DefaultDir = "/var/lib/drone/tarcache"
+
+	// DefaultKey is the default cache key template.
+	DefaultKey = "{{ .Branch }}"
+
+	// Image is the image used to create and extract cache
+	// archives in the build workspace.
+	Image = "gliderlabs/alpine:3.1"
+)
+
+// ext is the file extension of cache archives.
+const ext = ".tar"
+
+// Cache restores and saves workspace paths as tarballs
+// stored in a directory on the host machine. The directory
+// must be accessible to this process at the same path.
+type Cache struct {
+	Dir   string // host directory
+	Limit int64  // maximum size of all archives, in bytes
+}
+
+// Restore restores the workspace paths from the archive
+// matching the cache key, or the most recently used archive
+// matching one of the fallback keys.
+func (c *Cache) Restore(state *runner.State, conf *yaml.Cache) error {
+	keys, err := c.keys(state, conf)
+	if err != nil {
+		return err
+	}
+	name := c.lookup(repoDir(state), keys)
+	if len(name) == 0 {
+		log.Printf("Cache not found for key %s", keys[0])
+		return nil
+	}
+	log.Printf("Restoring cache %s", name)
+
+	// touch the archive to record the most recent use
+	// for least recently used eviction.
+	now := time.Now()
+	os.Chtimes(filepath.Join(c.Dir, name), now, now)
+
+	script := fmt.Sprintf("tar -xf %s -C %s",
+		quote(filepath.Join("/cache", filepath.Base(name))),
+		quote(state.Workspace.Path),
+	)
+	return c.run(state, script, nil)
+}
+
+// Save saves the workspace paths to an archive named by
+// the cache key. An existing archive for the key is not
+// replaced. The cache is not saved for pull requests or
+// untrusted repositories, which could otherwise replace
+// the archives restored by other builds.
+func (c *Cache) Save(state *runner.State, conf *yaml.Cache) error {
+	if state.Build.Event == plugin.EventPull || !state.Repo.IsTrusted {
+		log.Printf("Cache is not saved for pull requests or untrusted repositories")
+		return nil
+	}
+	if err := checkPaths(conf.Paths); err != nil {
+		return err
+	}
+	keys, err := c.keys(state, conf)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(repoDir(state), keys[0]+ext)
+	path := filepath.Join(c.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		log.Printf("Cache %s already exists", name)
+		return nil
+	}
+	log.Printf("Saving cache %s", name)
+
+	var paths []string
+	for _, p := range conf.Paths {
+		paths = append(paths, quote(p))
+	}
+	tmp := quote(filepath.Join("/cache", keys[0]+ext+".tmp"))
+	script := fmt.Sprintf(`set --
+for p in %s; do [ -e "$p" ] && set -- "$@" "$p"; done
+[ $# -eq 0 ] && exit 0
+tar -cf %s "$@"
+mv %s %s`,
+		strings.Join(paths, " "),
+		tmp,
+		tmp, quote(filepath.Join("/cache", keys[0]+ext)),
+	)
+	if err := c.run(state, script, nil); err != nil {
+		return err
+	}
+
+	max, err := ParseSize(conf.MaxSize)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && max > 0 && info.Size() > max {
+		log.Printf("Cache %s exceeds the maximum size %s, removing", name, conf.MaxSize)
+		os.Remove(path)
+	}
+	return c.evict()
+}
+
+// keys is a helper function that renders the cache key
+// followed by the fallback keys.
+func (c *Cache) keys(state *runner.State, conf *yaml.Cache) ([]string, error) {
+	templates := append([]string{conf.Key}, conf.Fallback...)
+	if len(templates[0]) == 0 {
+		templates[0] = DefaultKey
+	}
+
+	// the first pass collects the workspace files that
+	// must be checksummed to render the keys.
+	var files []string
+	for _, tmpl := range templates {
+		f, err := checksumFiles(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	sums := map[string]string{}
+	if len(files) != 0 {
+		var err error
+		sums, err = c.checksum(state, files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := newKeyData(state)
+	var keys []string
+	for _, tmpl := range templates {
+		key, err := renderKey(tmpl, data, sums)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// checksum is a helper function that calculates the
+// sha256 checksum of the files in the workspace.
+func (c *Cache) checksum(state *runner.State, files []string) (map[string]string, error) {
+	var quoted []string
+	for _, file := range files {
+		quoted = append(quoted, quote(file))
+	}
+	var buf bytes.Buffer
+	script := fmt.Sprintf("sha256sum %s 2>/dev/null; true", strings.Join(quoted, " "))
+	if err := c.run(state, script, &buf); err != nil {
+		return nil, err
+	}
+	return parseChecksums(buf.String()), nil
+}
+
+// lookup is a helper function that returns the name of the
+// archive, relative to the cache directory, matching the
+// first key exactly, or the most recently used archive
+// prefixed by one of the fallback keys.
+func (c *Cache) lookup(dir string, keys []string) string {
+	if _, err := os.Stat(filepath.Join(c.Dir, dir, keys[0]+ext)); err == nil {
+		return filepath.Join(dir, keys[0]+ext)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(c.Dir, dir))
+	if err != nil {
+		return ""
+	}
+	sort.Sort(sort.Reverse(byModTime(infos)))
+	for _, prefix := range keys[1:] {
+		for _, info := range infos {
+			name := info.Name()
+			if strings.HasSuffix(name, ext) && strings.HasPrefix(name, prefix) {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	return ""
+}
+
+// evict is a helper function that removes the least
+// recently used archives, across all repositories, until
+// the size of all archives is within the limit.
+func (c *Cache) evict() error {
+	if c.Limit <= 0 {
+		return nil
+	}
+	var archives []*archive
+	var total int64
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ext) {
+			return nil
+		}
+		archives = append(archives, &archive{path, info})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Sort(byLastUse(archives))
+	for _, a := range archives {
+		if total <= c.Limit {
+			break
+		}
+		log.Printf("Evicting cache %s", a.path)
+		if err := os.Remove(a.path); err != nil {
+			return err
+		}
+		total -= a.info.Size()
+	}
+	return nil
+}
+
+// run is a helper function that runs the shell script in
+// a container with access to the workspace and the cache
+// directory of the repository, mounted at /cache.
+func (c *Cache) run(state *runner.State, script string, outw *bytes.Buffer) error {
+	dir := filepath.Join(c.Dir, repoDir(state))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	conf := &dockerclient.ContainerConfig{
+		Image:      Image,
+		Entrypoint: []string{"/bin/sh", "-e", "-c"},
+		Cmd:        []string{script},
+		WorkingDir: state.Workspace.Path,
+		Volumes:    map[string]struct{}{"/cache": struct{}{}},
+		HostConfig: dockerclient.HostConfig{
+			Binds:            []string{dir + ":/cache"},
+			MemorySwappiness: -1,
+		},
+	}
+	var stdout, stderr = state.Stdout, state.Stderr
+	if outw != nil {
+		stdout = outw
+	}
+	info, err := docker.Run(state.Client, conf, nil, false, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	if info.State.ExitCode != 0 {
+		return fmt.Errorf("cache exited with code %d", info.State.ExitCode)
+	}
+	return nil
+}
+
+// checkPaths is a helper function that returns an error if
+// a cache path is not relative to the workspace.
+func checkPaths(paths []string) error {
+	for _, p := range paths {
+		clean := filepath.Clean(p)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("cache path %s is outside the workspace", p)
+		}
+	}
+	return nil
+}
+
+// repoDir is a helper function that returns the directory,
+// relative to the cache directory, of the repository
+// archives.
+func repoDir(state *runner.State) string {
+	return filepath.FromSlash(state.Repo.FullName)
+}
+
+// quote is a helper function that quotes the string for
+// use in a shell script.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+type archive struct {
+	path string
+	info os.FileInfo
+}
+
+type byLastUse []*archive
+
+func (s byLastUse) Len() int           { return len(s) }
+func (s byLastUse) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastUse) Less(i, j int) bool { return s[i].info.ModTime().Before(s[j].info.ModTime()) }
+
+type byModTime []os.FileInfo
+
+func (s byModTime) Len() int           { return len(s) }
+func (s byModTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byModTime) Less(i, j int) bool { return s[i].ModTime().Before(s[j].ModTime()) }
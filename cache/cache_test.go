@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-exec/runner"
+	"github.com/drone/drone-exec/yaml"
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/franela/goblin"
+)
+
+func TestCache(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Native cache", func() {
+
+		g.It("Should render the cache key", func() {
+			data := &keyData{Branch: "feature/foo", Matrix: map[string]string{"GO": "1.6"}}
+			sums := map[string]string{"go.sum": "3f9db97f"}
+			key, err := renderKey(`{{ .Branch }}-{{ .Matrix.GO }}-{{ checksum "go.sum" }}`, data, sums)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(key).Equal("feature_foo-1.6-3f9db97f")
+		})
+
+		g.It("Should collect the checksum files", func() {
+			files, err := checksumFiles(`{{ checksum "go.sum" }}-{{ checksum "web/package-lock.json" }}`)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(files).Equal([]string{"go.sum", "web/package-lock.json"})
+		})
+
+		g.It("Should parse the checksum output", func() {
+			sums := parseChecksums("3f9db97f  go.sum\nf661dd47  web/package-lock.json\n")
+			g.Assert(sums["go.sum"]).Equal("3f9db97f")
+			g.Assert(sums["web/package-lock.json"]).Equal("f661dd47")
+		})
+
+		g.It("Should parse sizes", func() {
+			n, _ := ParseSize("")
+			g.Assert(n).Equal(int64(0))
+			n, _ = ParseSize("512")
+			g.Assert(n).Equal(int64(512))
+			n, _ = ParseSize("2KB")
+			g.Assert(n).Equal(int64(2048))
+			n, _ = ParseSize("1 gb")
+			g.Assert(n).Equal(int64(1 << 30))
+			_, err := ParseSize("lots")
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should lookup archives by key and fallback keys", func() {
+			dir, _ := ioutil.TempDir("", "drone-cache")
+			defer os.RemoveAll(dir)
+			c := &Cache{Dir: dir}
+
+			writeArchive(dir, "octocat/hello/master-aaa.tar", 1, time.Hour)
+			writeArchive(dir, "octocat/hello/master-bbb.tar", 1, time.Minute)
+
+			g.Assert(c.lookup("octocat/hello", []string{"master-aaa"})).Equal("octocat/hello/master-aaa.tar")
+			g.Assert(c.lookup("octocat/hello", []string{"develop-ccc", "develop-", "master-"})).Equal("octocat/hello/master-bbb.tar")
+			g.Assert(c.lookup("octocat/hello", []string{"develop-ccc", "develop-"})).Equal("")
+		})
+
+		g.It("Should reject paths outside the workspace", func() {
+			g.Assert(checkPaths([]string{"vendor", "node_modules/.bin", "./.m2"}) == nil).IsTrue()
+			g.Assert(checkPaths([]string{"/cache"}).Error()).Equal("cache path /cache is outside the workspace")
+			g.Assert(checkPaths([]string{"vendor/../../other"}) == nil).IsFalse()
+			g.Assert(checkPaths([]string{".."}) == nil).IsFalse()
+		})
+
+		g.It("Should not save the cache of pull requests or untrusted repositories", func() {
+			c := &Cache{Dir: "/nonexistent"}
+			conf := &yaml.Cache{Paths: []string{"/cache"}}
+			state := &runner.State{
+				Repo:  &plugin.Repo{FullName: "octocat/hello", IsTrusted: true},
+				Build: &plugin.Build{Event: plugin.EventPull},
+			}
+			g.Assert(c.Save(state, conf) == nil).IsTrue()
+			state.Build.Event, state.Repo.IsTrusted = plugin.EventPush, false
+			g.Assert(c.Save(state, conf) == nil).IsTrue()
+			state.Repo.IsTrusted = true
+			g.Assert(c.Save(state, conf).Error()).Equal("cache path /cache is outside the workspace")
+		})
+
+		g.It("Should evict the least recently used archives", func() {
+			dir, _ := ioutil.TempDir("", "drone-cache")
+			defer os.RemoveAll(dir)
+			c := &Cache{Dir: dir, Limit: 20}
+
+			writeArchive(dir, "octocat/hello/master.tar", 10, time.Hour)
+			writeArchive(dir, "octocat/world/master.tar", 10, time.Minute)
+			writeArchive(dir, "octocat/hello/develop.tar", 10, time.Second)
+
+			g.Assert(c.evict() == nil).IsTrue()
+			_, err := os.Stat(filepath.Join(dir, "octocat/hello/master.tar"))
+			g.Assert(os.IsNotExist(err)).IsTrue()
+			_, err = os.Stat(filepath.Join(dir, "octocat/world/master.tar"))
+			g.Assert(err == nil).IsTrue()
+		})
+	})
+}
+
+// writeArchive is a helper function that writes a fake
+// archive of the given size, last used at the given age.
+func writeArchive(dir, name string, size int, age time.Duration) {
+	path := filepath.Join(dir, name)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	ioutil.WriteFile(path, make([]byte, size), 0644)
+	when := time.Now().Add(-age)
+	os.Chtimes(path, when, when)
+}
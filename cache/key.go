@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/drone/drone-exec/runner"
+)
+
+var unsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// keyData defines the data available to cache key
+// templates.
+type keyData struct {
+	Repo   string
+	Branch string
+	Commit string
+	Event  string
+	Matrix map[string]string
+}
+
+func newKeyData(state *runner.State) *keyData {
+	return &keyData{
+		Repo:   state.Repo.FullName,
+		Branch: state.Build.Branch,
+		Commit: state.Build.Commit,
+		Event:  state.Build.Event,
+		Matrix: state.Job.Environment,
+	}
+}
+
+// renderKey is a helper function that renders the cache
+// key template. The checksum function returns the checksum
+// of a workspace file from the precomputed checksums. The
+// key is sanitized for use as a file name.
+func renderKey(text string, data *keyData, sums map[string]string) (string, error) {
+	funcs := template.FuncMap{
+		"checksum": func(file string) string {
+			return sums[file]
+		},
+	}
+	tmpl, err := template.New("key").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing cache key %q: %s", text, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering cache key %q: %s", text, err)
+	}
+	return unsafeRegexp.ReplaceAllString(buf.String(), "_"), nil
+}
+
+// checksumFiles is a helper function that returns the files
+// passed to the checksum function by the cache key template.
+func checksumFiles(text string) ([]string, error) {
+	var files []string
+	funcs := template.FuncMap{
+		"checksum": func(file string) string {
+			files = append(files, file)
+			return ""
+		},
+	}
+	tmpl, err := template.New("key").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cache key %q: %s", text, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &keyData{}); err != nil {
+		return nil, fmt.Errorf("rendering cache key %q: %s", text, err)
+	}
+	return files, nil
+}
+
+// parseChecksums is a helper function that parses the
+// output of the sha256sum command.
+func parseChecksums(out string) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[fields[1]] = fields[0]
+	}
+	return sums
+}
+
+// ParseSize parses a size in bytes, optionally suffixed by
+// a unit such as KB, MB or GB. An empty string is parsed as
+// zero, meaning unlimited.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"TB", 1 << 40},
+		{"B", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return n * unit.size, nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
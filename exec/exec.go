@@ -3,15 +3,20 @@ package exec
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/drone/drone-exec/cache"
 	"github.com/drone/drone-exec/docker"
 	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-exec/report"
 	"github.com/drone/drone-exec/runner"
 	"github.com/drone/drone-exec/yaml"
 	"github.com/drone/drone-exec/yaml/inject"
@@ -35,8 +40,11 @@ type Payload struct {
 	Job       *plugin.Job       `json:"job"`
 	Netrc     *plugin.Netrc     `json:"netrc"`
 	Keys      *plugin.Keypair   `json:"keys"`
-	System    *plugin.System    `json:"system"`
+	System    *System           `json:"system"`
 	Workspace *plugin.Workspace `json:"workspace"`
+	Changes   []string          `json:"changed_files"`
+	Deploy    string            `json:"deploy_to"`
+	Files     map[string]string `json:"files"`
 }
 
 // Options defines execution options.
@@ -49,6 +57,14 @@ type Options struct {
 	Debug  bool   // execute in debug mode
 	Force  bool   // force pull plugin images
 	Mount  string // mounts the volume on the host machine
+	Junit  string // writes a junit report to the file
+	LogDir string // writes the output of each step to the directory
+	Policy string // reads the administrator policy from the file
+
+	Pipeline string // executes the named pipeline only
+
+	CacheDir  string // host directory of the native cache
+	CacheSize string // maximum size of the native cache
 }
 
 // Error reports an error during execution of a build.
@@ -59,8 +75,18 @@ type Error struct {
 func (e *Error) Error() string { return fmt.Sprintf("build failed (exit code %d)", e.ExitCode) }
 
 // Exec executes a build with the given payload and options. If the
-// build fails, an *Error is returned.
+// Yaml declares named pipelines, each pipeline is executed in turn.
+// If the build fails, an *Error is returned.
 func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
+	if len(opt.Policy) != 0 {
+		policy, err := ReadPolicy(opt.Policy)
+		if err != nil {
+			return fmt.Errorf("reading policy file: %s", err)
+		}
+		payload.System.merge(policy)
+		log.Debugf("Using policy file %s", opt.Policy)
+	}
+
 	var sec *secure.Secure
 	if payload.Keys != nil && len(payload.YamlEnc) != 0 {
 		var err error
@@ -71,6 +97,10 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 		log.Debugln("Successfully decrypted secrets")
 	}
 
+	// files read at runtime are injected following the
+	// same rules as the Yaml.
+	files := &fileInjector{private: payload.Repo.IsPrivate}
+
 	// TODO This block of code (and the above block) need to be cleaned
 	//      up and written in a manner that facilitates better unit testing.
 	if sec != nil {
@@ -91,9 +121,11 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 			if err != nil {
 				return fmt.Errorf("injecting yaml secrets: %s", err)
 			}
+			files.secrets, files.safe = sec.Environment.Map(), true
 		case verified:
 			log.Debugln("Injected secrets into Yaml")
 			payload.Yaml = inject.Inject(payload.Yaml, sec.Environment.Map())
+			files.secrets = sec.Environment.Map()
 		case !verified:
 			// if we can't validate the Yaml file we don't inject
 			// secrets, and therefore shouldn't bother running the
@@ -117,6 +149,7 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 	}
 	payload.Yaml = inject.Inject(payload.Yaml, payload.Job.Environment)
 	payload.Yaml = inject.Inject(payload.Yaml, injectParams)
+	files.params = []map[string]string{payload.Job.Environment, injectParams}
 
 	// safely inject global variables
 	var globals = map[string]string{}
@@ -132,6 +165,94 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 	} else {
 		payload.Yaml, _ = inject.InjectSafe(payload.Yaml, globals)
 	}
+	files.globals = globals
+
+	// variables left after injection are reported, and
+	// escaped variables are unescaped.
+	for _, name := range inject.Unknown(payload.Yaml) {
+		log.Warnf("Unknown variable %s in Yaml", name)
+	}
+	payload.Yaml = inject.Unescape(payload.Yaml)
+
+	pipelines, err := yaml.ParsePipelinesString(payload.Yaml)
+	if err != nil {
+		return err
+	}
+
+	// watch for sigkill (timeout or cancel build)
+	active := new(tracker)
+	killc := make(chan os.Signal, 1)
+	signal.Notify(killc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-killc
+		log.Println("Cancel request received, killing process")
+		active.destroy() // possibe race here. implement lock on the other end
+		os.Exit(130)     // cancel is treated like ctrl+c
+	}()
+
+	go func() {
+		var timeout = payload.Repo.Timeout
+		if timeout == 0 {
+			timeout = 60
+		}
+		<-time.After(time.Duration(timeout) * time.Minute)
+		log.Println("Timeout request received, killing process")
+		active.destroy() // possibe race here. implement lock on the other end
+		os.Exit(128)     // cancel is treated like ctrl+c
+	}()
+
+	// each pipeline is executed in order, in its own
+	// workspace, and reports its own status. The build
+	// fails if any of the pipelines fail.
+	var steps []*runner.Step
+	var failed error
+	var found bool
+	for _, pipeline := range pipelines {
+		if len(opt.Pipeline) != 0 && pipeline.Name != opt.Pipeline {
+			continue
+		}
+		found = true
+		if len(pipeline.Name) != 0 {
+			log.Printf("Running pipeline %s", pipeline.Name)
+		}
+		s, err := execPipeline(payload, pipeline, opt, files, outw, errw, active)
+		steps = append(steps, s...)
+		switch err.(type) {
+		case nil:
+		case *Error:
+			if len(pipeline.Name) != 0 {
+				log.Printf("Pipeline %s failed. %s", pipeline.Name, err)
+			}
+			if failed == nil {
+				failed = err
+			}
+		default:
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown pipeline %q", opt.Pipeline)
+	}
+
+	if len(opt.Junit) != 0 {
+		log.Debugf("Writing junit report %s", opt.Junit)
+		err = writeJUnit(opt.Junit, steps)
+		if err != nil {
+			log.Errorf("Error writing junit report. %s", err)
+		}
+	}
+	return failed
+}
+
+// execPipeline executes a single pipeline with the given
+// payload and options, and returns the executed steps. If
+// the pipeline fails, an *Error is returned.
+func execPipeline(payload Payload, pipeline *yaml.Pipeline, opt Options, files *fileInjector, outw, errw io.Writer, active *tracker) ([]*runner.Step, error) {
+	payload.Yaml = pipeline.Yaml
+
+	// each pipeline reports its own status.
+	build, job := *payload.Build, *payload.Job
+	payload.Build, payload.Job = &build, &job
 
 	// extracts the clone path from the yaml. If
 	// the clone path doesn't exist it uses a path
@@ -141,15 +262,52 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 	payload.Workspace.Root = "/drone/src"
 	log.Debugf("Using workspace %s", payload.Workspace.Path)
 
+	// the log index is written however the pipeline ends,
+	// listing the steps executed so far, if any.
+	var state *runner.State
+	var logdir *report.LogDir
+	if len(opt.LogDir) != 0 {
+		dir := filepath.Join(opt.LogDir, pipeline.Name)
+		log.Debugf("Writing step logs to %s", dir)
+		var err error
+		logdir, err = report.NewLogDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("creating log directory: %s", err)
+		}
+		defer func() {
+			var steps []*runner.Step
+			if state != nil {
+				steps = state.Steps
+			}
+			if err := logdir.WriteIndex(steps); err != nil {
+				log.Errorf("Error writing log index. %s", err)
+			}
+		}()
+	}
+
+	conf, err := pipeline.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := importCompose(conf, payload, opt); err != nil {
+		return nil, err
+	}
 	rules := []parser.RuleFunc{
 		parser.ImageName,
-		parser.ImageMatchFunc(payload.System.Plugins),
+		parser.EnvFileFunc(func(d *parser.DockerNode, name string) ([]byte, error) {
+			in, err := readFile(payload, opt, name)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(files.inject(string(in), d.NodeType == parser.NodeBuild)), nil
+		}),
+		parser.ImagePolicyFunc(payload.System.imagePolicy()),
 		parser.ImagePullFunc(opt.Force),
-		parser.SanitizeFunc(payload.Repo.IsTrusted), //&& !plugin.PullRequest(payload.Build)
+		parser.SanitizePolicyFunc(payload.Repo.IsTrusted, payload.System.Sanitize), //&& !plugin.PullRequest(payload.Build)
 		parser.CacheFunc(payload.Repo.FullName),
 		parser.DebugFunc(yaml.ParseDebugString(payload.Yaml)),
-		parser.Escalate,
-		parser.HttpProxy,
+		parser.EscalateFunc(payload.System.escalatePolicy()),
+		parser.ProxyFunc(payload.System.Proxy),
 		parser.DefaultNotifyFilter,
 	}
 	if len(opt.Mount) != 0 {
@@ -162,52 +320,47 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 			payload.Workspace.Path,
 		))
 	}
-	tree, err := parser.Parse(payload.Yaml, rules)
+	tree, err := parser.Load(conf, rules)
 	if err != nil {
 		// TODO(sqs): There was a comment here saying "print error
 		// messages in debug mode only". Is this because of security
 		// (e.g., the decrypted YAML secrets could leak in the error
 		// message)? If so, don't return the err here; instead, return
 		// a simple error message such as "error parsing yaml".
-		return err
+		return nil, err
 	}
 	r := runner.Load(tree)
 
+	// the native cache restores and saves workspace paths
+	// without the use of a cache plugin.
+	var tarcache *cache.Cache
+	var cacheConf = yaml.ParseCacheString(payload.Yaml)
+	if opt.Cache && cacheConf != nil {
+		tarcache = &cache.Cache{Dir: opt.CacheDir}
+		if len(tarcache.Dir) == 0 {
+			tarcache.Dir = cache.DefaultDir
+		}
+		tarcache.Limit, err = cache.ParseSize(opt.CacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cache size: %s", err)
+		}
+	}
+
 	client, err := dockerclient.NewDockerClient("unix:///var/run/docker.sock", nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// // creates a wrapper Docker client that uses an ambassador
 	// // container to create a pod-like environment.
 	controller, err := docker.NewClient(client)
 	if err != nil {
-		return fmt.Errorf("creating docker ambassador container: %s", err)
+		return nil, fmt.Errorf("creating docker ambassador container: %s", err)
 	}
 	defer controller.Destroy()
+	active.set(controller)
 
-	// watch for sigkill (timeout or cancel build)
-	killc := make(chan os.Signal, 1)
-	signal.Notify(killc, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-killc
-		log.Println("Cancel request received, killing process")
-		controller.Destroy() // possibe race here. implement lock on the other end
-		os.Exit(130)         // cancel is treated like ctrl+c
-	}()
-
-	go func() {
-		var timeout = payload.Repo.Timeout
-		if timeout == 0 {
-			timeout = 60
-		}
-		<-time.After(time.Duration(timeout) * time.Minute)
-		log.Println("Timeout request received, killing process")
-		controller.Destroy() // possibe race here. implement lock on the other end
-		os.Exit(128)         // cancel is treated like ctrl+c
-	}()
-
-	state := &runner.State{
+	state = &runner.State{
 		Client:    controller,
 		Stdout:    outw,
 		Stderr:    errw,
@@ -215,8 +368,15 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 		Build:     payload.Build,
 		BuildLast: payload.BuildLast,
 		Job:       payload.Job,
-		System:    payload.System,
+		System:    &payload.System.System,
 		Workspace: payload.Workspace,
+		Escalate:  payload.System.escalatePolicy(),
+		Changes:   payload.Changes,
+		Deploy:    payload.Deploy,
+		Pipeline:  pipeline.Name,
+	}
+	if logdir != nil {
+		state.Logger = logdir
 	}
 	if opt.Cache {
 		log.Debugln("Running Cache step")
@@ -232,6 +392,20 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 			log.Debugln(err)
 		}
 	}
+	if state.Changes == nil && hasPaths(tree) && !state.Failed() {
+		log.Debugln("Listing changed files")
+		state.Changes, err = runner.Diff(state)
+		if err != nil {
+			log.Errorf("Error listing changed files. %s", err)
+		}
+	}
+	if tarcache != nil && !state.Failed() {
+		log.Debugln("Restoring Cache")
+		err = tarcache.Restore(state, cacheConf)
+		if err != nil {
+			log.Errorf("Error restoring cache. %s", err)
+		}
+	}
 	if opt.Build && !state.Failed() {
 		log.Debugln("Running Build and Compose steps")
 		err = r.RunNode(state, parser.NodeCompose|parser.NodeBuild)
@@ -261,6 +435,13 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 			log.Debugln(err)
 		}
 	}
+	if tarcache != nil && !state.Failed() {
+		log.Debugln("Saving Cache")
+		err = tarcache.Save(state, cacheConf)
+		if err != nil {
+			log.Errorf("Error saving cache. %s", err)
+		}
+	}
 	if opt.Notify {
 		log.Debugln("Running Notify steps")
 		err = r.RunNode(state, parser.NodeNotify)
@@ -271,8 +452,107 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 
 	if state.Failed() {
 		controller.Destroy()
-		return &Error{ExitCode: state.ExitCode()}
+		return state.Steps, &Error{ExitCode: state.ExitCode()}
+	}
+
+	return state.Steps, nil
+}
+
+// writeJUnit is a helper function that writes the executed
+// steps to a JUnit report file.
+func writeJUnit(name string, steps []*runner.Step) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	return report.JUnit(f, steps)
+}
+
+// hasPaths is a helper function that returns true if any
+// step is limited by a changed path condition.
+func hasPaths(tree *parser.Tree) (found bool) {
+	parser.Inspect(tree.Root, func(n parser.Node) bool {
+		if f, ok := n.(*parser.FilterNode); ok {
+			found = found || len(f.PathsInclude) != 0 || len(f.PathsExclude) != 0
+		}
+		return !found
+	})
+	return
+}
 
+// importCompose is a helper function that imports the services
+// of the docker-compose file of the pipeline, if any. The file
+// is read before the clone step, see readFile.
+func importCompose(conf *yaml.Config, payload Payload, opt Options) error {
+	file := conf.Compose.File()
+	if len(file) == 0 {
+		return nil
+	}
+	in, err := readFile(payload, opt, file)
+	if err != nil {
+		return fmt.Errorf("reading compose file: %s", err)
+	}
+	if err := conf.Compose.Import(in); err != nil {
+		return err
+	}
+	log.Debugf("Imported compose file %s", file)
 	return nil
 }
+
+// readFile is a helper function that reads a file of the
+// repository, such as a docker-compose file. The file is
+// read from the payload, or from the workspace if mounted
+// from the host machine. Files are read when the Yaml is
+// parsed, before the clone step, so the workspace is not
+// available unless mounted.
+func readFile(payload Payload, opt Options, name string) ([]byte, error) {
+	if in, ok := payload.Files[name]; ok {
+		return []byte(in), nil
+	}
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return nil, fmt.Errorf("%s is outside the workspace", name)
+	}
+	if len(opt.Mount) == 0 {
+		return nil, fmt.Errorf("%s not found in payload. Files are read before the repository is cloned, and must be in the payload or the workspace mounted with --mount", name)
+	}
+
+	// symlinks are resolved to verify the file is still in
+	// the workspace, since the repository may link to any
+	// file on the host.
+	mount, err := filepath.EvalSymlinks(opt.Mount)
+	if err != nil {
+		return nil, err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(mount, clean))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(mount, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside the workspace", name)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// tracker tracks the ambassador container of the running
+// pipeline, which is destroyed if the build is cancelled.
+type tracker struct {
+	sync.Mutex
+	client *docker.Client
+}
+
+func (t *tracker) set(client *docker.Client) {
+	t.Lock()
+	t.client = client
+	t.Unlock()
+}
+
+func (t *tracker) destroy() {
+	t.Lock()
+	defer t.Unlock()
+	if t.client != nil {
+		t.client.Destroy()
+	}
+}
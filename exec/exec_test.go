@@ -0,0 +1,78 @@
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-exec/yaml"
+	"github.com/franela/goblin"
+)
+
+func TestReadFile(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "drone-exec")
+	defer os.RemoveAll(dir)
+
+	mount := filepath.Join(dir, "src")
+	os.Mkdir(mount, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("hunter2"), 0644)
+	ioutil.WriteFile(filepath.Join(mount, "docker-compose.yml"), []byte("redis: {}"), 0644)
+	os.Symlink(filepath.Join(dir, "secret"), filepath.Join(mount, "link.yml"))
+
+	g := goblin.Goblin(t)
+	g.Describe("Read file", func() {
+
+		g.It("Should read the file from the payload", func() {
+			payload := Payload{Files: map[string]string{"docker-compose.yml": "mysql: {}"}}
+			in, err := readFile(payload, Options{Mount: mount}, "docker-compose.yml")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(in)).Equal("mysql: {}")
+		})
+
+		g.It("Should read the file from the workspace", func() {
+			in, err := readFile(Payload{}, Options{Mount: mount}, "docker-compose.yml")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(in)).Equal("redis: {}")
+		})
+
+		g.It("Should not read the workspace before the clone", func() {
+			_, err := readFile(Payload{}, Options{}, "docker-compose.yml")
+			g.Assert(err.Error()).Equal("docker-compose.yml not found in payload. Files are read before the repository is cloned, and must be in the payload or the workspace mounted with --mount")
+		})
+
+		g.It("Should not read files outside the workspace", func() {
+			_, err := readFile(Payload{}, Options{Mount: mount}, "../secret")
+			g.Assert(err == nil).IsFalse()
+			_, err = readFile(Payload{}, Options{Mount: mount}, filepath.Join(dir, "secret"))
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should not follow symlinks outside the workspace", func() {
+			_, err := readFile(Payload{}, Options{Mount: mount}, "link.yml")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
+
+func TestImportCompose(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Import compose", func() {
+
+		g.It("Should import services from the payload", func() {
+			conf, _ := yaml.ParseString("compose:\n  file: docker-compose.yml\n")
+			payload := Payload{Files: map[string]string{"docker-compose.yml": "redis:\n  image: redis\n"}}
+			err := importCompose(conf, payload, Options{})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Compose.Slice()[0].Name).Equal("redis")
+		})
+
+		g.It("Should fail before the clone without a mounted workspace", func() {
+			conf, _ := yaml.ParseString("compose:\n  file: docker-compose.yml\n")
+			err := importCompose(conf, Payload{}, Options{})
+			g.Assert(err.Error()).Equal("reading compose file: docker-compose.yml not found in payload. Files are read before the repository is cloned, and must be in the payload or the workspace mounted with --mount")
+		})
+	})
+}
@@ -0,0 +1,31 @@
+package exec
+
+import "github.com/drone/drone-exec/yaml/inject"
+
+// fileInjector injects the secrets, matrix parameters and
+// global variables into files read at runtime, such as
+// environment files, following the rules used to inject
+// them into the Yaml.
+type fileInjector struct {
+	secrets map[string]string
+	safe    bool // secrets are not injected into build steps
+	params  []map[string]string
+	globals map[string]string
+	private bool // globals are injected into build steps
+}
+
+// inject injects the parameters into the file and unescapes
+// escaped variables. The build flag indicates the file is
+// read for a build step.
+func (i *fileInjector) inject(in string, build bool) string {
+	if !i.safe || !build {
+		in = inject.Inject(in, i.secrets)
+	}
+	for _, params := range i.params {
+		in = inject.Inject(in, params)
+	}
+	if i.private || !build {
+		in = inject.Inject(in, i.globals)
+	}
+	return inject.Unescape(in)
+}
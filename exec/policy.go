@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"io/ioutil"
+
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-plugin-go/plugin"
+	"gopkg.in/yaml.v2"
+)
+
+// System represents the system section of the payload,
+// extended with the policy configured by the administrator.
+type System struct {
+	plugin.System
+	Policy
+}
+
+// Policy defines the administrator policy applied to the
+// build. The policy is provided in the system section of
+// the payload, or in a policy file on the host machine.
+type Policy struct {
+	Images   *parser.ImagePolicy    `json:"image_policy" yaml:"image_policy"`
+	Escalate *parser.EscalatePolicy `json:"escalate" yaml:"escalate"`
+	Sanitize *parser.SanitizePolicy `json:"sanitize" yaml:"sanitize"`
+	Proxy    *parser.ProxyConfig    `json:"proxy" yaml:"proxy"`
+}
+
+// ParsePolicy parses a policy file in Yaml or JSON format.
+func ParsePolicy(in []byte) (*Policy, error) {
+	policy := &Policy{}
+	err := yaml.Unmarshal(in, policy)
+	return policy, err
+}
+
+// ReadPolicy reads and parses the policy file.
+func ReadPolicy(file string) (*Policy, error) {
+	in, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(in)
+}
+
+// merge overrides the policy with the sections defined in
+// the other policy.
+func (p *Policy) merge(other *Policy) {
+	if other == nil {
+		return
+	}
+	if other.Images != nil {
+		p.Images = other.Images
+	}
+	if other.Escalate != nil {
+		p.Escalate = other.Escalate
+	}
+	if other.Sanitize != nil {
+		p.Sanitize = other.Sanitize
+	}
+	if other.Proxy != nil {
+		p.Proxy = other.Proxy
+	}
+}
+
+// imagePolicy is a helper function that returns the image
+// policy, defaulting the plugin whitelist to the plugins
+// listed in the system section.
+func (s *System) imagePolicy() *parser.ImagePolicy {
+	policy := parser.ImagePolicy{}
+	if s.Images != nil {
+		policy = *s.Images
+	}
+	if len(policy.Allow) == 0 {
+		policy.Allow = s.Plugins
+	}
+	return &policy
+}
+
+// escalatePolicy is a helper function that returns the
+// escalation policy, or the default policy if none is
+// configured.
+func (s *System) escalatePolicy() *parser.EscalatePolicy {
+	if s.Escalate == nil {
+		return parser.DefaultEscalate
+	}
+	return s.Escalate
+}
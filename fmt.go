@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone/drone-exec/yaml/format"
+)
+
+// fmtFiles formats each Yaml configuration file and prints
+// the result, or writes it back to the file if the -w flag
+// is set. It returns a non-zero exit code if any file cannot
+// be formatted.
+func fmtFiles(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{".drone.yml"}
+	}
+	code := 0
+	for _, file := range files {
+		in, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		out, err := format.Format(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			code = 1
+			continue
+		}
+		if !*write {
+			os.Stdout.Write(out)
+			continue
+		}
+		if bytes.Equal(in, out) {
+			continue
+		}
+		if err := ioutil.WriteFile(file, out, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	return code
+}
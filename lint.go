@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone/drone-exec/yaml/lint"
+)
+
+// lintFiles parses each Yaml configuration file strictly and
+// prints all issues found. It returns a non-zero exit code
+// if any issues are found.
+func lintFiles(files []string) int {
+	if len(files) == 0 {
+		files = []string{".drone.yml"}
+	}
+	code := 0
+	for _, file := range files {
+		in, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		issues, err := lint.Lint(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			code = 1
+			continue
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, issue)
+			code = 1
+		}
+	}
+	return code
+}
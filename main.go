@@ -14,6 +14,17 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(lintFiles(os.Args[2:]))
+		case "fmt":
+			os.Exit(fmtFiles(os.Args[2:]))
+		case "convert":
+			os.Exit(convertFiles(os.Args[2:]))
+		}
+	}
+
 	var opt exec.Options
 
 	// parses command line flags
@@ -25,6 +36,12 @@ func main() {
 	flag.BoolVar(&opt.Debug, "debug", false, "")
 	flag.BoolVar(&opt.Force, "pull", false, "")
 	flag.StringVar(&opt.Mount, "mount", "", "")
+	flag.StringVar(&opt.Junit, "junit", "", "")
+	flag.StringVar(&opt.LogDir, "log-dir", "", "")
+	flag.StringVar(&opt.Policy, "policy", "", "")
+	flag.StringVar(&opt.Pipeline, "pipeline", "", "")
+	flag.StringVar(&opt.CacheDir, "cache-dir", "", "")
+	flag.StringVar(&opt.CacheSize, "cache-size", "", "")
 	flag.Parse()
 
 	// unmarshal the json payload via stdin or
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/drone/drone-exec/yaml"
+)
+
+// mergeDefaults merges the environment and default settings
+// of the pipeline into every Docker node of the tree. The
+// settings of the step take precedence.
+func (t *Tree) mergeDefaults(conf *yaml.Config) {
+	env := conf.Environment.Slice()
+	defaults := conf.Defaults
+	Inspect(t.Root, func(n Node) bool {
+		d, ok := n.(*DockerNode)
+		if !ok {
+			return true
+		}
+		if len(env) != 0 {
+			d.Environment = mergeEnv(env, d.Environment)
+			d.inherited = inherited(env, d.Environment)
+		}
+		if _, ok := d.Keys["pull"]; !ok && defaults.Pull {
+			d.Pull = true
+		}
+		d.Volumes = mergeList(defaults.Volumes, d.Volumes, volumeTarget)
+		d.ExtraHosts = mergeList(defaults.ExtraHosts, d.ExtraHosts, hostName)
+		d.DNS = mergeList(defaults.DNS.Slice(), d.DNS, nil)
+		d.DNSSearch = mergeList(defaults.DNSSearch.Slice(), d.DNSSearch, nil)
+		if len(d.Net) == 0 {
+			d.Net = defaults.Net
+		}
+		if d.AuthConfig == (yaml.AuthConfig{}) {
+			d.AuthConfig = defaults.AuthConfig
+		}
+		return true
+	})
+}
+
+// mergeList is a helper function that merges the default
+// values under the values of the step. Defaults with the
+// same key as a value of the step are omitted. If the key
+// function is nil, defaults are omitted if the step declares
+// any values.
+func mergeList(defaults, values []string, key func(string) string) []string {
+	if len(defaults) == 0 {
+		return values
+	}
+	if key == nil {
+		if len(values) != 0 {
+			return values
+		}
+		return defaults
+	}
+	declared := map[string]bool{}
+	for _, v := range values {
+		declared[key(v)] = true
+	}
+	var merged []string
+	for _, v := range defaults {
+		if !declared[key(v)] {
+			merged = append(merged, v)
+		}
+	}
+	return append(merged, values...)
+}
+
+// inherited is a helper function that returns the names of
+// the pipeline variables not overridden by the step.
+func inherited(env, merged []string) map[string]bool {
+	names := map[string]bool{}
+	for _, v := range env {
+		for _, m := range merged {
+			if m == v {
+				names[envName(v)] = true
+			}
+		}
+	}
+	return names
+}
+
+// volumeTarget returns the container path of the volume.
+func volumeTarget(volume string) string {
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 {
+		return volume
+	}
+	return parts[1]
+}
+
+// hostName returns the hostname of the extra host.
+func hostName(host string) string {
+	return strings.SplitN(host, ":", 2)[0]
+}
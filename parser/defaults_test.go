@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestDefaults(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Defaults", func() {
+
+		g.It("Should merge the environment into every step", func() {
+			tree := New(parseConfig(sampleDefaults))
+			build := tree.Root.Nodes[1].(*FilterNode).Node.(*DockerNode)
+			g.Assert(build.Environment).Equal([]string{"GOOS=linux", "GOARCH=arm"})
+			notify := tree.Root.Nodes[2].(*FilterNode).Node.(*DockerNode)
+			g.Assert(notify.Environment).Equal([]string{"GOOS=linux", "GOARCH=amd64"})
+		})
+
+		g.It("Should merge the default settings into every step", func() {
+			tree := New(parseConfig(sampleDefaults))
+			build := tree.Root.Nodes[1].(*FilterNode).Node.(*DockerNode)
+			g.Assert(build.Pull).IsFalse()
+			g.Assert(build.Volumes).Equal([]string{"/tmp/go:/go", "/tmp/build:/cache"})
+			g.Assert(build.ExtraHosts).Equal([]string{"registry:10.0.0.1"})
+			g.Assert(build.AuthConfig.Username).Equal("octocat")
+
+			notify := tree.Root.Nodes[2].(*FilterNode).Node.(*DockerNode)
+			g.Assert(notify.Pull).IsTrue()
+			g.Assert(notify.Volumes).Equal([]string{"/tmp/cache:/cache"})
+			g.Assert(notify.ExtraHosts).Equal([]string{"registry:10.0.0.1", "cache:10.0.0.2"})
+			g.Assert(notify.AuthConfig.Username).Equal("hubot")
+		})
+
+		g.It("Should let environment files override the pipeline environment", func() {
+			tree := New(parseConfig(sampleDefaults))
+			build := tree.Root.Nodes[1].(*FilterNode).Node.(*DockerNode)
+			build.EnvFile = []string{"ci.env"}
+			read := func(d *DockerNode, name string) ([]byte, error) {
+				return []byte("GOOS=darwin\nGOARCH=386\n"), nil
+			}
+			EnvFileFunc(read)(nil, build)
+			g.Assert(build.Environment).Equal([]string{"GOOS=darwin", "GOARCH=arm"})
+		})
+	})
+}
+
+var sampleDefaults = `
+environment:
+  - GOOS=linux
+  - GOARCH=amd64
+defaults:
+  pull: true
+  volumes: [ /tmp/cache:/cache ]
+  extra_hosts: [ "registry:10.0.0.1" ]
+  auth_config:
+    username: octocat
+build:
+  image: golang
+  pull: false
+  environment: [ GOARCH=arm ]
+  volumes: [ /tmp/go:/go, /tmp/build:/cache ]
+notify:
+  slack:
+    extra_hosts: [ "cache:10.0.0.2" ]
+    auth_config:
+      username: hubot
+`
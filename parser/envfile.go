@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drone/drone-exec/yaml/dotenv"
+)
+
+// EnvFileFunc returns a RuleFunc that reads the environment
+// files of each step, using the read function, and merges
+// the variables under the environment of the step. Variables
+// in later files override variables in earlier files, and
+// variables of the pipeline environment.
+func EnvFileFunc(read func(d *DockerNode, name string) ([]byte, error)) RuleFunc {
+	return func(t *Tree, n Node) error {
+		d, ok := n.(*DockerNode)
+		if !ok || len(d.EnvFile) == 0 {
+			return nil
+		}
+		var env []string
+		for _, name := range d.EnvFile {
+			in, err := read(d, name)
+			if err != nil {
+				return fmt.Errorf("reading env_file %s: %s", name, err)
+			}
+			vars, err := dotenv.Parse(in)
+			if err != nil {
+				return fmt.Errorf("env_file %s: %s", name, err)
+			}
+			env = append(env, vars...)
+		}
+		var shared, explicit []string
+		for _, v := range d.Environment {
+			if d.inherited[envName(v)] {
+				shared = append(shared, v)
+			} else {
+				explicit = append(explicit, v)
+			}
+		}
+		d.Environment = mergeEnv(mergeEnv(shared, env), explicit)
+		return nil
+	}
+}
+
+// mergeEnv is a helper function that merges the variables
+// under the explicit variables. Later variables override
+// earlier variables with the same name.
+func mergeEnv(vars, explicit []string) []string {
+	defined := map[string]bool{}
+	for _, v := range explicit {
+		defined[envName(v)] = true
+	}
+	var env []string
+	for i, v := range vars {
+		name := envName(v)
+		if defined[name] || redefined(vars[i+1:], name) {
+			continue
+		}
+		env = append(env, v)
+	}
+	return append(env, explicit...)
+}
+
+// redefined is a helper function that returns true if the
+// variable is defined in the list.
+func redefined(vars []string, name string) bool {
+	for _, v := range vars {
+		if envName(v) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func envName(v string) string {
+	return strings.SplitN(v, "=", 2)[0]
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestEnvFile(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("EnvFile rule", func() {
+
+		files := map[string]string{
+			"base.env":  "A=1\nB=2\nC=3\n",
+			"local.env": "B=two\n",
+			"bad.env":   "A\n",
+		}
+		read := func(d *DockerNode, name string) ([]byte, error) {
+			in, ok := files[name]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return []byte(in), nil
+		}
+
+		g.It("Should merge files under the environment", func() {
+			n := &DockerNode{
+				EnvFile:     []string{"base.env", "local.env"},
+				Environment: []string{"C=three"},
+			}
+			err := EnvFileFunc(read)(nil, n)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n.Environment).Equal([]string{"A=1", "B=two", "C=three"})
+		})
+
+		g.It("Should report unreadable files", func() {
+			n := &DockerNode{EnvFile: []string{"missing.env"}}
+			err := EnvFileFunc(read)(nil, n)
+			g.Assert(err.Error()).Equal("reading env_file missing.env: not found")
+		})
+
+		g.It("Should report malformed files", func() {
+			n := &DockerNode{EnvFile: []string{"bad.env"}}
+			err := EnvFileFunc(read)(nil, n)
+			g.Assert(err.Error()).Equal("env_file bad.env: line 1: expected = after A")
+		})
+
+		g.It("Should ignore steps without files", func() {
+			n := &DockerNode{Environment: []string{"A=1"}}
+			err := EnvFileFunc(read)(nil, n)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n.Environment).Equal([]string{"A=1"})
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/drone/drone-exec/yaml"
+)
+
+// RuleError reports a rule that failed for a step in the
+// Yaml configuration file.
+type RuleError struct {
+	Section string        // section of the Yaml, e.g. build
+	Index   int           // position of the step in the section
+	Name    string        // name of the step, if any
+	Image   string        // image of the step, if known
+	Pos     yaml.Position // position of the step, if known
+	Err     error
+}
+
+func (e *RuleError) Error() string {
+	var prefix string
+	if e.Pos.IsValid() {
+		prefix = e.Pos.String() + ": "
+	}
+	step := fmt.Sprintf("%s step %d", e.Section, e.Index+1)
+	if len(e.Name) != 0 {
+		step = fmt.Sprintf("%s step %s", e.Section, e.Name)
+	}
+	if len(e.Image) == 0 {
+		return fmt.Sprintf("%s%s: %s", prefix, step, e.Err)
+	}
+	return fmt.Sprintf("%s%s (%s): %s", prefix, step, e.Image, e.Err)
+}
+
+// Errors is a list of errors reported while applying
+// rules to the parse tree.
+type Errors []error
+
+func (e Errors) Error() string {
+	var buf bytes.Buffer
+	for i, err := range e {
+		if i != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
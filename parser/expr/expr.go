@@ -0,0 +1,210 @@
+// Package expr implements a small expression language used
+// to evaluate the conditions of a when section, for example:
+//
+//	branch == "main" && event != "pull_request" || matrix.GO == "1.6"
+//
+// Expressions compare string values using the ==, != and =~
+// (glob match) operators, and combine the results using the
+// &&, || and ! operators and parentheses. Identifiers are
+// resolved against the variables passed to Eval, and unknown
+// variables evaluate to the empty string. Expressions have
+// no side effects and always terminate.
+package expr
+
+import (
+	"fmt"
+	"path"
+)
+
+// Expr is a parsed expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression.
+func Parse(src string) (*Expr, error) {
+	p := &parser{lex: newLexer(src)}
+	p.next()
+	root, err := p.parseOr()
+	switch {
+	case err != nil:
+	case p.tok.kind == tokError:
+		err = p.errorf("%s", p.tok.val)
+	case p.tok.kind != tokEOF:
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", src, err)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Eval evaluates the expression using the variables.
+func (e *Expr) Eval(vars map[string]string) bool {
+	return truthy(e.root.eval(vars))
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// node is a node of the expression syntax tree. Each node
+// evaluates to a string, where boolean results are "true"
+// or "false".
+type node interface {
+	eval(vars map[string]string) string
+}
+
+type (
+	literal  string
+	variable string
+
+	notNode struct {
+		x node
+	}
+	binaryNode struct {
+		op   string
+		x, y node
+	}
+)
+
+func (n literal) eval(map[string]string) string {
+	return string(n)
+}
+
+func (n variable) eval(vars map[string]string) string {
+	return vars[string(n)]
+}
+
+func (n *notNode) eval(vars map[string]string) string {
+	return boolString(!truthy(n.x.eval(vars)))
+}
+
+func (n *binaryNode) eval(vars map[string]string) string {
+	switch n.op {
+	case "&&":
+		return boolString(truthy(n.x.eval(vars)) && truthy(n.y.eval(vars)))
+	case "||":
+		return boolString(truthy(n.x.eval(vars)) || truthy(n.y.eval(vars)))
+	case "==":
+		return boolString(n.x.eval(vars) == n.y.eval(vars))
+	case "!=":
+		return boolString(n.x.eval(vars) != n.y.eval(vars))
+	case "=~":
+		match, _ := path.Match(n.y.eval(vars), n.x.eval(vars))
+		return boolString(match)
+	}
+	return "false"
+}
+
+// truthy returns true if the value is not empty and not
+// false.
+func truthy(s string) bool {
+	return len(s) != 0 && s != "false"
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("column %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses: and { "||" and }
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.tok.kind == tokOp && p.tok.val == "||" {
+		p.next()
+		var y node
+		y, err = p.parseAnd()
+		x = &binaryNode{"||", x, y}
+	}
+	return x, err
+}
+
+// parseAnd parses: unary { "&&" unary }
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseUnary()
+	for err == nil && p.tok.kind == tokOp && p.tok.val == "&&" {
+		p.next()
+		var y node
+		y, err = p.parseUnary()
+		x = &binaryNode{"&&", x, y}
+	}
+	return x, err
+}
+
+// parseUnary parses: "!" unary | "(" or ")" | compare
+func (p *parser) parseUnary() (node, error) {
+	switch {
+	case p.tok.kind == tokOp && p.tok.val == "!":
+		p.next()
+		x, err := p.parseUnary()
+		return &notNode{x}, err
+	case p.tok.kind == tokLParen:
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ), got %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	}
+	return p.parseCompare()
+}
+
+// parseCompare parses: operand [ ( "==" | "!=" | "=~" ) operand ]
+func (p *parser) parseCompare() (node, error) {
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return x, nil
+	}
+	switch op := p.tok.val; op {
+	case "==", "!=", "=~":
+		p.next()
+		y, err := p.parseOperand()
+		return &binaryNode{op, x, y}, err
+	}
+	return x, nil
+}
+
+// parseOperand parses: identifier | string | number
+func (p *parser) parseOperand() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokIdent:
+		p.next()
+		switch tok.val {
+		case "true", "false":
+			return literal(tok.val), nil
+		}
+		return variable(tok.val), nil
+	case tokString, tokNumber:
+		p.next()
+		return literal(tok.val), nil
+	case tokError:
+		return nil, p.errorf("%s", tok.val)
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
@@ -0,0 +1,59 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestExpr(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Expressions", func() {
+
+		vars := map[string]string{
+			"branch":    "main",
+			"event":     "push",
+			"matrix.GO": "1.6",
+		}
+
+		g.It("Should evaluate comparisons", func() {
+			g.Assert(eval(`branch == "main"`, vars)).IsTrue()
+			g.Assert(eval(`branch != 'main'`, vars)).IsFalse()
+			g.Assert(eval(`matrix.GO == 1.6`, vars)).IsTrue()
+			g.Assert(eval(`branch =~ "ma*"`, vars)).IsTrue()
+			g.Assert(eval(`matrix.NODE == ""`, vars)).IsTrue()
+		})
+
+		g.It("Should evaluate boolean operators by precedence", func() {
+			g.Assert(eval(`branch == "main" && event != "pull_request" || matrix.GO == "1.6"`, vars)).IsTrue()
+			g.Assert(eval(`branch == "dev" && event == "push" || matrix.GO == "1.5"`, vars)).IsFalse()
+			g.Assert(eval(`branch == "dev" && (event == "push" || matrix.GO == "1.6")`, vars)).IsFalse()
+			g.Assert(eval(`!(branch == "dev") && !false`, vars)).IsTrue()
+		})
+
+		g.It("Should evaluate variables as booleans", func() {
+			g.Assert(eval(`matrix.GO`, vars)).IsTrue()
+			g.Assert(eval(`matrix.NODE`, vars)).IsFalse()
+		})
+
+		g.It("Should report parse errors", func() {
+			_, err := Parse(`branch == "main`)
+			g.Assert(err.Error()).Equal(`invalid expression "branch == \"main": column 11: unterminated string`)
+			_, err = Parse(`branch == "main" &&`)
+			g.Assert(err.Error()).Equal(`invalid expression "branch == \"main\" &&": column 20: unexpected end of expression`)
+			_, err = Parse(`(branch == "main"`)
+			g.Assert(err.Error()).Equal(`invalid expression "(branch == \"main\"": column 18: expected ), got end of expression`)
+			_, err = Parse(`branch = "main"`)
+			g.Assert(err.Error()).Equal(`invalid expression "branch = \"main\"": column 8: unexpected character '='`)
+		})
+	})
+}
+
+func eval(src string, vars map[string]string) bool {
+	e, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return e.Eval(vars)
+}
@@ -0,0 +1,117 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokError
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", t.val)
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+// operators defines the operators, longest first.
+var operators = []string{"&&", "||", "==", "!=", "=~", "!"}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{tokLParen, "(", start}
+	case c == ')':
+		l.pos++
+		return token{tokRParen, ")", start}
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case isDigit(c):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{tokNumber, l.src[start:l.pos], start}
+	case isLetter(c):
+		for l.pos < len(l.src) && (isLetter(l.src[l.pos]) || isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{tokIdent, l.src[start:l.pos], start}
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{tokOp, op, start}
+		}
+	}
+	l.pos = len(l.src)
+	return token{tokError, fmt.Sprintf("unexpected character %q", c), start}
+}
+
+// lexString scans a quoted string. A backslash escapes the
+// following character.
+func (l *lexer) lexString(quote byte) token {
+	start := l.pos
+	l.pos++
+	var buf []byte
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch {
+		case c == quote:
+			return token{tokString, string(buf), start}
+		case c == '\\' && l.pos < len(l.src):
+			buf = append(buf, l.src[l.pos])
+			l.pos++
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return token{tokError, "unterminated string", start}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
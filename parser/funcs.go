@@ -3,10 +3,11 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 var (
@@ -21,12 +22,13 @@ const (
 )
 
 // RuleFunc defines a function used to validate or modify the yaml during
-// the parsing process.
-type RuleFunc func(Node) error
+// the parsing process. Each node is passed along with the whole tree, for
+// rules that depend on other steps.
+type RuleFunc func(*Tree, Node) error
 
 // ImageName expands to a fully qualified image name. If no image name is found,
 // a default is used when possible, else ErrImageMissing is returned.
-func ImageName(n Node) error {
+func ImageName(t *Tree, n Node) error {
 	d, ok := n.(*DockerNode)
 	if !ok {
 		return nil
@@ -90,7 +92,7 @@ func ImageMatch(n Node, patterns []string) error {
 }
 
 func ImageMatchFunc(patterns []string) RuleFunc {
-	return func(n Node) error {
+	return func(t *Tree, n Node) error {
 		return ImageMatch(n, patterns)
 	}
 }
@@ -109,54 +111,72 @@ func ImagePull(n Node, pull bool) error {
 }
 
 func ImagePullFunc(pull bool) RuleFunc {
-	return func(n Node) error {
+	return func(t *Tree, n Node) error {
 		return ImagePull(n, pull)
 	}
 }
 
 // Sanitize sanitizes a Docker Node by removing any potentially
 // harmful configuration options.
-func Sanitize(n Node) error {
-	d, ok := n.(*DockerNode)
-	if !ok {
-		return nil
-	}
-	d.Privileged = false
-	d.Volumes = nil
-	d.Net = ""
-	d.Entrypoint = []string{}
-	return nil
+func Sanitize(t *Tree, n Node) error {
+	return SanitizePolicyFunc(false, nil)(t, n)
 }
 
 func SanitizeFunc(trusted bool) RuleFunc {
-	return func(n Node) error {
-		if !trusted {
-			return Sanitize(n)
+	return SanitizePolicyFunc(trusted, nil)
+}
+
+// SanitizePolicyFunc returns a RuleFunc that sanitizes Docker
+// Nodes of untrusted repositories, removing any configuration
+// options not allowed by the policy. A nil policy allows none.
+func SanitizePolicyFunc(trusted bool, policy *SanitizePolicy) RuleFunc {
+	if policy == nil {
+		policy = &SanitizePolicy{}
+	}
+	return func(t *Tree, n Node) error {
+		d, ok := n.(*DockerNode)
+		if !ok || trusted {
+			return nil
+		}
+		removed := policy.Apply(d)
+		if len(removed) == 0 {
+			return nil
+		}
+		name := d.Name
+		if len(name) == 0 {
+			name = d.Image
 		}
+		log.Printf("Sanitized %s step %s, removed %s",
+			Section(d.NodeType),
+			name,
+			strings.Join(removed, ", "),
+		)
 		return nil
 	}
 }
 
 // Escalate escalates a Docker Node to run in privileged mode if
-// the plugin is whitelisted.
-func Escalate(n Node) error {
-	d, ok := n.(*DockerNode)
-	if !ok {
-		return nil
-	}
-	image := strings.Split(d.Image, ":")
-	if d.NodeType == NodePublish && (image[0] == "plugins/drone-docker" || image[0] == "plugins/drone-gcr") {
+// the plugin is whitelisted by the default escalation policy.
+func Escalate(t *Tree, n Node) error {
+	return EscalateFunc(DefaultEscalate)(t, n)
+}
 
-		d.Privileged = true
-		d.Volumes = nil
-		d.Net = ""
-		d.Entrypoint = []string{}
-		//d.Volumes = []string{"/lib/modules:/lib/modules"}
+// EscalateFunc returns a RuleFunc that escalates publish plugins
+// matching the escalation policy.
+func EscalateFunc(policy *EscalatePolicy) RuleFunc {
+	return func(t *Tree, n Node) error {
+		d, ok := n.(*DockerNode)
+		if !ok || policy == nil {
+			return nil
+		}
+		if d.NodeType == NodePublish && policy.Match(d.Image) {
+			policy.Apply(d)
+		}
+		return nil
 	}
-	return nil
 }
 
-func DefaultNotifyFilter(n Node) error {
+func DefaultNotifyFilter(t *Tree, n Node) error {
 	f, ok := n.(*FilterNode)
 	if !ok || f.Node == nil {
 		return nil
@@ -188,21 +208,9 @@ func DefaultNotifyFilter(n Node) error {
 }
 
 // HttpProxy injects the HTTP_PROXY and HTTPS_PROXY environment
-// variables into the container.
-func HttpProxy(n Node) error {
-	d, ok := n.(*DockerNode)
-	if !ok {
-		return nil
-	}
-	for _, env := range os.Environ() {
-		envup := strings.ToUpper(env)
-		if strings.HasPrefix(envup, "HTTP_PROXY") ||
-			strings.HasPrefix(envup, "HTTPS_PROXY") ||
-			strings.HasPrefix(envup, "NO_PROXY") {
-			d.Environment = append([]string{env}, d.Environment...)
-		}
-	}
-	return nil
+// variables of the current process into the container.
+func HttpProxy(t *Tree, n Node) error {
+	return ProxyFunc(nil)(t, n)
 }
 
 // Cache transforms the Docker Node to mount a volume to the host
@@ -215,12 +223,13 @@ func Cache(n Node, dir string) error {
 	if d.NodeType == NodeCache {
 		dir = fmt.Sprintf("/var/lib/drone/cache/%s:/cache", dir)
 		d.Volumes = []string{dir}
+		d.mounts = []string{dir}
 	}
 	return nil
 }
 
 func CacheFunc(dir string) RuleFunc {
-	return func(n Node) error {
+	return func(t *Tree, n Node) error {
 		return Cache(n, dir)
 	}
 }
@@ -240,7 +249,7 @@ func Debug(n Node, debug bool) error {
 }
 
 func DebugFunc(debug bool) RuleFunc {
-	return func(n Node) error {
+	return func(t *Tree, n Node) error {
 		return Debug(n, debug)
 	}
 }
@@ -252,11 +261,12 @@ func Mount(n Node, from, to string) error {
 	}
 	dir := fmt.Sprintf("%s:%s", from, to)
 	d.Volumes = append(d.Volumes, dir)
+	d.mounts = append(d.mounts, dir)
 	return nil
 }
 
 func MountFunc(from, to string) RuleFunc {
-	return func(n Node) error {
+	return func(t *Tree, n Node) error {
 		return Mount(n, from, to)
 	}
 }
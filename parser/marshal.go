@@ -0,0 +1,245 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/drone/drone-exec/yaml"
+	goyaml "gopkg.in/yaml.v2"
+)
+
+// Marshal renders the Tree, including any changes made by
+// the rules, back to a Yaml build definition. Trees of the
+// version 2 Yaml are rendered as a pipeline section. Registry
+// passwords and tokens are omitted.
+func Marshal(t *Tree) ([]byte, error) {
+	return goyaml.Marshal(t)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (t *Tree) MarshalYAML() (interface{}, error) {
+	if t.Version >= yaml.Version2 {
+		return t.marshalPipeline(), nil
+	}
+
+	var steps = map[NodeType][]*DockerNode{}
+	var filters = map[*DockerNode]*FilterNode{}
+	var order []NodeType
+
+	for _, node := range t.Root.Nodes {
+		var filter *FilterNode
+		if f, ok := node.(*FilterNode); ok {
+			filter, node = f, f.Node
+		}
+		d, ok := node.(*DockerNode)
+		if !ok {
+			continue
+		}
+		if _, ok := steps[d.NodeType]; !ok {
+			order = append(order, d.NodeType)
+		}
+		steps[d.NodeType] = append(steps[d.NodeType], d)
+		filters[d] = filter
+	}
+
+	var doc goyaml.MapSlice
+	for _, typ := range order {
+		var value interface{}
+		switch nodes := steps[typ]; {
+		case typ == NodeCache || typ == NodeClone:
+			value = marshalStep(nodes[0], filters[nodes[0]])
+		case typ == NodeBuild && len(nodes) == 1 && len(nodes[0].Name) == 0:
+			value = marshalStep(nodes[0], filters[nodes[0]])
+		default:
+			var named goyaml.MapSlice
+			var seen = map[string]int{}
+			for _, node := range nodes {
+				named = append(named, goyaml.MapItem{
+					Key:   stepKey(node, seen),
+					Value: marshalStep(node, filters[node]),
+				})
+			}
+			value = named
+		}
+		doc = append(doc, goyaml.MapItem{Key: Section(typ), Value: value})
+	}
+	return doc, nil
+}
+
+// marshalPipeline is a helper function that renders the
+// steps of the version 2 Yaml in the pipeline section.
+func (t *Tree) marshalPipeline() goyaml.MapSlice {
+	var pipeline []interface{}
+	var seen = map[string]int{}
+	for _, node := range t.Root.Nodes {
+		var filter *FilterNode
+		if f, ok := node.(*FilterNode); ok {
+			filter, node = f, f.Node
+		}
+		d, ok := node.(*DockerNode)
+		if !ok {
+			continue
+		}
+		m := mapSlice{
+			{Key: "name", Value: stepKey(d, seen)},
+			{Key: "type", Value: stepType(d.NodeType)},
+		}
+		m = append(m, marshalContainer(d)...)
+		if len(d.Vargs) != 0 {
+			m = append(m, goyaml.MapItem{Key: "settings", Value: goyaml.MapSlice(marshalVargs(d))})
+		}
+		m.add("when", goyaml.MapSlice(marshalFilter(filter)))
+		pipeline = append(pipeline, goyaml.MapSlice(m))
+	}
+	return goyaml.MapSlice{
+		{Key: "version", Value: t.Version},
+		{Key: "pipeline", Value: pipeline},
+	}
+}
+
+// stepType is a helper function that returns the step type
+// of the version 2 Yaml of the node type.
+func stepType(typ NodeType) string {
+	for name, t := range stepTypes {
+		if t == typ {
+			return name
+		}
+	}
+	return ""
+}
+
+// marshalStep is a helper function that renders the step
+// and its filter, omitting empty values.
+func marshalStep(d *DockerNode, f *FilterNode) goyaml.MapSlice {
+	m := marshalContainer(d)
+	m = append(m, marshalVargs(d)...)
+	m.add("when", goyaml.MapSlice(marshalFilter(f)))
+	return goyaml.MapSlice(m)
+}
+
+// marshalContainer is a helper function that renders the
+// container options of the step, omitting empty values.
+func marshalContainer(d *DockerNode) mapSlice {
+	var m mapSlice
+	m.add("image", d.Image)
+	m.add("pull", d.Pull)
+	m.add("privileged", d.Privileged)
+	m.add("environment", d.Environment)
+	m.add("env_file", d.EnvFile)
+	m.add("entrypoint", d.Entrypoint)
+	m.add("command", d.Command)
+	m.add("commands", d.Commands)
+	m.add("volumes", d.Volumes)
+	m.add("extra_hosts", d.ExtraHosts)
+	m.add("net", d.Net)
+	m.add("working_dir", d.WorkingDir)
+	m.add("user", d.User)
+	m.add("hostname", d.Hostname)
+	m.add("dns", d.DNS)
+	m.add("dns_search", d.DNSSearch)
+	m.add("tmpfs", d.Tmpfs)
+	m.add("cap_add", d.CapAdd)
+	m.add("cap_drop", d.CapDrop)
+	m.add("devices", d.Devices)
+	if !d.Proxy {
+		m = append(m, goyaml.MapItem{Key: "proxy", Value: false})
+	}
+
+	// the registry password and token are omitted, so that
+	// the rendered Yaml can be printed.
+	var auth mapSlice
+	auth.add("username", d.AuthConfig.Username)
+	auth.add("email", d.AuthConfig.Email)
+	m.add("auth_config", goyaml.MapSlice(auth))
+	if d.Healthcheck != nil {
+		m = append(m, goyaml.MapItem{Key: "healthcheck", Value: d.Healthcheck})
+	}
+	return m
+}
+
+// marshalVargs is a helper function that renders the plugin
+// arguments of the step, sorted by name.
+func marshalVargs(d *DockerNode) mapSlice {
+	var keys []string
+	for key := range d.Vargs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var m mapSlice
+	for _, key := range keys {
+		m = append(m, goyaml.MapItem{Key: key, Value: d.Vargs[key]})
+	}
+	return m
+}
+
+// marshalFilter is a helper function that renders the when
+// section of the step, omitting empty values.
+func marshalFilter(f *FilterNode) mapSlice {
+	var when mapSlice
+	if f != nil {
+		when.add("repo", f.Repo)
+		when.add("branch", f.Branch)
+		when.add("event", f.Event)
+		when.add("success", f.Success)
+		when.add("failure", f.Failure)
+		when.add("change", f.Change)
+		when.add("matrix", f.Matrix)
+		when.add("expr", f.Expr)
+		var paths mapSlice
+		paths.add("include", f.PathsInclude)
+		paths.add("exclude", f.PathsExclude)
+		when.add("paths", goyaml.MapSlice(paths))
+		when.add("tag", f.Tag)
+		when.add("environment", f.Environment)
+	}
+	return when
+}
+
+// stepKey is a helper function that returns the key of a
+// named step. Steps without a name are keyed by the image
+// name, and duplicate keys are suffixed with a number.
+func stepKey(d *DockerNode, seen map[string]int) string {
+	key := d.Name
+	if len(key) == 0 {
+		key = path.Base(trimImageTag(d.Image))
+		key = strings.TrimPrefix(key, "drone-")
+	}
+	seen[key]++
+	if n := seen[key]; n > 1 {
+		key = fmt.Sprintf("%s_%d", key, n)
+	}
+	return key
+}
+
+type mapSlice goyaml.MapSlice
+
+// add appends the key and value to the mapping, unless the
+// value is empty.
+func (m *mapSlice) add(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if len(v) == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case map[string]string:
+		if len(v) == 0 {
+			return
+		}
+	case goyaml.MapSlice:
+		if len(v) == 0 {
+			return
+		}
+	}
+	*m = append(*m, goyaml.MapItem{Key: key, Value: value})
+}
@@ -24,6 +24,24 @@ const (
 	NodePublish
 )
 
+// sections maps node types to the name of the Yaml
+// section in which they are declared.
+var sections = map[NodeType]string{
+	NodeBuild:   "build",
+	NodeCache:   "cache",
+	NodeClone:   "clone",
+	NodeDeploy:  "deploy",
+	NodeCompose: "compose",
+	NodeNotify:  "notify",
+	NodePublish: "publish",
+}
+
+// Section returns the name of the Yaml section in which
+// nodes of the given type are declared.
+func Section(t NodeType) string {
+	return sections[t]
+}
+
 // Nodes.
 
 type Node interface {
@@ -50,33 +68,72 @@ func newListNode() *ListNode {
 type DockerNode struct {
 	NodeType
 
+	Name        string
 	Image       string
 	Pull        bool
 	Privileged  bool
 	Environment []string
+	EnvFile     []string // environment files, merged under the environment
 	Entrypoint  []string
 	Command     []string
 	Commands    []string
 	Volumes     []string
 	ExtraHosts  []string
+	CapAdd      []string
+	CapDrop     []string
+	Devices     []string
 	Net         string
+	WorkingDir  string // relative to the workspace
+	User        string
+	Hostname    string
+	DNS         []string
+	DNSSearch   []string
+	Tmpfs       []string
+	Proxy       bool // inject the proxy environment variables
 	AuthConfig  yaml.AuthConfig
+	Healthcheck *yaml.Healthcheck // wait for the service to be healthy
 	Vargs       map[string]interface{}
+
+	Pos  yaml.Position            // position of the step
+	Keys map[string]yaml.Position // position of each key
+
+	// inherited records the names of the variables of the
+	// pipeline environment, which environment files override.
+	inherited map[string]bool
+
+	// mounts records the volumes added by the Mount and Cache
+	// rules, which escalation does not remove.
+	mounts []string
 }
 
 func newDockerNode(typ NodeType, c yaml.Container) *DockerNode {
 	return &DockerNode{
 		NodeType:    typ,
+		Name:        c.Name,
 		Image:       c.Image,
 		Pull:        c.Pull,
 		Privileged:  c.Privileged,
 		Environment: c.Environment.Slice(),
+		EnvFile:     c.EnvFile.Slice(),
 		Entrypoint:  c.Entrypoint.Slice(),
 		Command:     c.Command.Slice(),
 		Volumes:     c.Volumes,
 		ExtraHosts:  c.ExtraHosts,
 		Net:         c.Net,
+		WorkingDir:  c.WorkingDir,
+		User:        c.User,
+		Hostname:    c.Hostname,
+		DNS:         c.DNS.Slice(),
+		DNSSearch:   c.DNSSearch.Slice(),
+		Tmpfs:       c.Tmpfs.Slice(),
+		CapAdd:      c.CapAdd,
+		CapDrop:     c.CapDrop,
+		Devices:     c.Devices,
+		Proxy:       c.Proxy == nil || *c.Proxy,
 		AuthConfig:  c.AuthConfig,
+		Healthcheck: c.Healthcheck,
+		Pos:         c.Pos,
+		Keys:        c.Keys,
 	}
 }
 
@@ -105,6 +162,15 @@ type FilterNode struct {
 	Failure string
 	Change  string
 	Matrix  map[string]string
+	Expr    string // expression, see package expr
+
+	PathsInclude []string // changed file patterns
+	PathsExclude []string
+
+	Tag         []string // tag patterns
+	Environment []string // deployment environment patterns
+
+	Pos yaml.Position // position of the when section
 
 	Node Node // Node to execution if conditions met
 }
@@ -119,5 +185,14 @@ func newFilterNode(filter yaml.Filter) *FilterNode {
 		Success:  filter.Success,
 		Failure:  filter.Failure,
 		Change:   filter.Change,
+		Expr:     filter.Expr,
+
+		PathsInclude: filter.Paths.Include.Slice(),
+		PathsExclude: filter.Paths.Exclude.Slice(),
+
+		Tag:         filter.Tag.Slice(),
+		Environment: filter.Environment.Slice(),
+
+		Pos: filter.Pos,
 	}
 }
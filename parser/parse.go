@@ -1,19 +1,21 @@
 package parser
 
-import "github.com/drone/drone-exec/yaml"
+import (
+	"github.com/drone/drone-exec/parser/expr"
+	"github.com/drone/drone-exec/yaml"
+)
 
 // Tree is the representation of a parsed build
 // configuraiton Yaml file.
 type Tree struct {
-	Root  *ListNode
-	rules []RuleFunc
+	Root    *ListNode
+	Version int // version of the Yaml configuration file
 }
 
 // newTree allocates a new parse tree.
-func newTree(rules []RuleFunc) *Tree {
+func newTree() *Tree {
 	return &Tree{
-		Root:  &ListNode{NodeType: NodeList},
-		rules: rules,
+		Root: &ListNode{NodeType: NodeList},
 	}
 }
 
@@ -30,116 +32,180 @@ func Parse(raw string, rules []RuleFunc) (*Tree, error) {
 // Load loads the Yaml build definition structure
 // and returns an execution Tree.
 func Load(conf *yaml.Config, rules []RuleFunc) (*Tree, error) {
-	var tree = newTree(rules)
-	var err error
-
-	// Cache.
-	err = tree.appendCache(conf.Cache)
-	if err != nil {
+	tree := New(conf)
+	if err := tree.Apply(rules); err != nil {
 		return nil, err
 	}
+	return tree, nil
+}
 
-	// Clone.
-	err = tree.appendPlugin(NodeClone, conf.Clone)
-	if err != nil {
-		return nil, err
+// New constructs the complete execution Tree from the
+// Yaml build definition structure, without applying any
+// rules.
+func New(conf *yaml.Config) *Tree {
+	var tree = newTree()
+	tree.Version = conf.Version
+	if conf.Version >= yaml.Version2 {
+		tree.appendSteps(conf.Pipeline.Slice())
+	} else {
+		tree.appendCache(conf.Cache)
+		tree.appendPlugin(NodeClone, conf.Clone)
+		tree.appendCompose(conf.Compose.Slice())
+		tree.appendBuild(conf.Build.Slice())
+		tree.appendPlugin(NodePublish, conf.Publish.Slice()...)
+		tree.appendPlugin(NodeDeploy, conf.Deploy.Slice()...)
+		tree.appendPlugin(NodeNotify, conf.Notify.Slice()...)
 	}
+	tree.mergeDefaults(conf)
+	return tree
+}
 
-	// Compose.
-	err = tree.appendCompose(conf.Compose.Slice())
-	if err != nil {
-		return nil, err
-	}
+// Apply applies the rules to every node in the Tree. Each
+// rule is applied to a step's DockerNode, followed by its
+// FilterNode. Rule errors do not halt processing of other
+// steps; all errors are collected and returned as Errors.
+// Filter expressions are always validated.
+func (t *Tree) Apply(rules []RuleFunc) error {
+	var errs Errors
+	var index = map[NodeType]int{}
+
+	rules = append([]RuleFunc{checkExpr}, rules...)
+
+	for _, node := range t.Root.Nodes {
+		var docker *DockerNode
+		var nodes []Node
+
+		switch n := node.(type) {
+		case *FilterNode:
+			docker, _ = n.Node.(*DockerNode)
+			nodes = []Node{n.Node, n}
+		case *DockerNode:
+			docker = n
+			nodes = []Node{n}
+		default:
+			nodes = []Node{n}
+		}
 
-	// Build
-	err = tree.appendBuild(conf.Build.Slice())
-	if err != nil {
-		return nil, err
+		err := t.applyRules(rules, nodes)
+		if err != nil && docker != nil {
+			err = &RuleError{
+				Section: Section(docker.NodeType),
+				Index:   index[docker.NodeType],
+				Name:    docker.Name,
+				Image:   docker.Image,
+				Pos:     docker.Pos,
+				Err:     err,
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if docker != nil {
+			index[docker.NodeType]++
+		}
 	}
 
-	// Publish.
-	err = tree.appendPlugin(NodePublish, conf.Publish.Slice()...)
-	if err != nil {
-		return nil, err
+	if len(errs) != 0 {
+		return errs
 	}
+	return nil
+}
 
-	// Deploy.
-	err = tree.appendPlugin(NodeDeploy, conf.Deploy.Slice()...)
-	if err != nil {
-		return nil, err
+// applyRules is a helper function that applies the rules
+// to each node in order, returning the first error.
+func (t *Tree) applyRules(rules []RuleFunc, nodes []Node) error {
+	for _, node := range nodes {
+		for _, rule := range rules {
+			if err := rule(t, node); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	// Plugin.
-	err = tree.appendPlugin(NodeNotify, conf.Notify.Slice()...)
-	if err != nil {
-		return nil, err
+// checkExpr is a helper function that returns an error if
+// the filter expression cannot be parsed.
+func checkExpr(t *Tree, n Node) error {
+	f, ok := n.(*FilterNode)
+	if !ok || len(f.Expr) == 0 {
+		return nil
 	}
-
-	return tree, nil
+	_, err := expr.Parse(f.Expr)
+	return err
 }
 
-func (t *Tree) appendPlugin(typ NodeType, plugins ...yaml.Plugin) error {
+func (t *Tree) appendPlugin(typ NodeType, plugins ...yaml.Plugin) {
 	for _, plugin := range plugins {
-		node := newPluginNode(typ, plugin)
-		for _, rule := range t.rules {
-			err := rule(node)
-			if err != nil {
-				return err
-			}
-		}
 		fnode := newFilterNode(plugin.Filter)
-		fnode.Node = node
-		// TODO: we should apply rules to all nodes in
-		// the tree AFTER the entire tree is constructed.
-		for _, rule := range t.rules {
-			err := rule(fnode)
-			if err != nil {
-				return err
-			}
-		}
+		fnode.Node = newPluginNode(typ, plugin)
 		t.Root.append(fnode)
 	}
-	return nil
 }
 
-func (t *Tree) appendBuild(builds []yaml.Build) error {
+func (t *Tree) appendBuild(builds []yaml.Build) {
 	for _, build := range builds {
-		node := newBuildNode(NodeBuild, build)
-		for _, rule := range t.rules {
-			if err := rule(node); err != nil {
-				return err
-			}
-		}
-
 		fnode := newFilterNode(build.Filter)
-		fnode.Node = node
-		for _, rule := range t.rules {
-			if err := rule(fnode); err != nil {
-				return err
-			}
-		}
+		fnode.Node = newBuildNode(NodeBuild, build)
 		t.Root.append(fnode)
 	}
-	return nil
 }
 
-func (t *Tree) appendCache(cache yaml.Plugin) error {
+func (t *Tree) appendCache(cache yaml.Plugin) {
 	if len(cache.Vargs) == 0 {
-		return nil
+		return
+	}
+	// the native cache is restored and saved by the
+	// cache package, and is not executed as a plugin.
+	if _, ok := cache.Vargs["paths"]; ok {
+		return
 	}
-	return t.appendPlugin(NodeCache, cache)
+	t.appendPlugin(NodeCache, cache)
 }
 
-func (t *Tree) appendCompose(plugins []yaml.Container) error {
-	for _, plugin := range plugins {
-		node := newDockerNode(NodeCompose, plugin)
-		for _, rule := range t.rules {
-			err := rule(node)
-			if err != nil {
-				return err
-			}
+// stepTypes maps the step types of the version 2 Yaml to
+// node types.
+var stepTypes = map[string]NodeType{
+	yaml.StepClone:   NodeClone,
+	yaml.StepCache:   NodeCache,
+	yaml.StepService: NodeCompose,
+	yaml.StepBuild:   NodeBuild,
+	yaml.StepPublish: NodePublish,
+	yaml.StepDeploy:  NodeDeploy,
+	yaml.StepNotify:  NodeNotify,
+}
+
+// appendSteps appends the steps of the version 2 Yaml in
+// order. The default clone step is prepended if the steps
+// do not include a clone step.
+func (t *Tree) appendSteps(steps []yaml.Step) {
+	var clone bool
+	for _, step := range steps {
+		clone = clone || step.Type == yaml.StepClone
+	}
+	if !clone {
+		t.appendPlugin(NodeClone, yaml.Plugin{})
+	}
+	for _, step := range steps {
+		typ := stepTypes[step.Type]
+		node := newDockerNode(typ, step.Container)
+		switch typ {
+		case NodeBuild:
+			node.Commands = step.Commands
+		case NodeCompose:
+		default:
+			node.Vargs = step.Settings
 		}
-		t.Root.append(node)
+		fnode := newFilterNode(step.Filter)
+		fnode.Node = node
+		t.Root.append(fnode)
+	}
+}
+
+func (t *Tree) appendCompose(services []yaml.Service) {
+	for _, service := range services {
+		fnode := newFilterNode(service.Filter)
+		fnode.Node = newDockerNode(NodeCompose, service.Container)
+		t.Root.append(fnode)
 	}
-	return nil
 }
@@ -1 +1,126 @@
 package parser
+
+import (
+	"testing"
+
+	"github.com/drone/drone-exec/yaml"
+	"github.com/franela/goblin"
+)
+
+func TestParse(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Parse tree", func() {
+
+		g.It("Should wrap compose nodes in a filter", func() {
+			tree, err := Parse(sampleCompose, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(tree.Root.Nodes)).Equal(3)
+			f, ok := tree.Root.Nodes[1].(*FilterNode)
+			g.Assert(ok).IsTrue()
+			g.Assert(f.Node.Type()).Equal(NodeCompose)
+		})
+
+		g.It("Should filter compose nodes by their when section", func() {
+			tree, err := Parse("compose:\n  elasticsearch:\n    image: elasticsearch\n    when:\n      matrix: { SUITE: integration }\n", nil)
+			g.Assert(err == nil).IsTrue()
+			f := tree.Root.Nodes[1].(*FilterNode)
+			g.Assert(f.Matrix).Equal(map[string]string{"SUITE": "integration"})
+			g.Assert(f.Node.(*DockerNode).Name).Equal("elasticsearch")
+		})
+
+		g.It("Should apply rules after the tree is built", func() {
+			var seen int
+			rule := func(t *Tree, n Node) error {
+				if _, ok := n.(*DockerNode); ok {
+					seen++
+				}
+				return nil
+			}
+			tree := New(parseConfig(sampleCompose))
+			g.Assert(seen).Equal(0)
+			err := tree.Apply([]RuleFunc{rule})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(seen).Equal(3)
+		})
+
+		g.It("Should build the tree of a version 2 Yaml in order", func() {
+			tree, err := Parse(sampleVersion2, []RuleFunc{ImageName})
+			g.Assert(err == nil).IsTrue()
+			var types []NodeType
+			var images []string
+			for _, n := range tree.Root.Nodes {
+				d := n.(*FilterNode).Node.(*DockerNode)
+				types = append(types, d.NodeType)
+				images = append(images, d.Image)
+			}
+			g.Assert(types).Equal([]NodeType{NodeClone, NodeCompose, NodeBuild, NodeNotify})
+			g.Assert(images).Equal([]string{"plugins/drone-git:latest", "redis:latest", "golang:latest", "plugins/drone-slack:latest"})
+
+			d := tree.Root.Nodes[2].(*FilterNode).Node.(*DockerNode)
+			g.Assert(d.Name).Equal("test")
+			g.Assert(d.Commands).Equal([]string{"go test"})
+			d = tree.Root.Nodes[3].(*FilterNode).Node.(*DockerNode)
+			g.Assert(d.Vargs["channel"]).Equal("dev")
+		})
+
+		g.It("Should collect all rule errors", func() {
+			_, err := Parse(sampleInvalid, []RuleFunc{
+				ImageName,
+				ImageMatchFunc([]string{"plugins/*"}),
+			})
+			errs, ok := err.(Errors)
+			g.Assert(ok).IsTrue()
+			g.Assert(len(errs)).Equal(2)
+			g.Assert(errs[0].Error()).Equal(".drone.yml:3:3: build step backend: Yaml must specify an image for every step")
+			g.Assert(errs[1].Error()).Equal(".drone.yml:8:3: deploy step octocat/heroku (octocat/heroku:latest): Plugin octocat/heroku:latest is not in the whitelist")
+		})
+
+		g.It("Should report invalid filter expressions", func() {
+			_, err := Parse("build: { image: golang, when: { expr: 'branch = \"main\"' } }", nil)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(err.Error()).Equal(`.drone.yml:1:1: build step 1 (golang): invalid expression "branch = \"main\"": column 8: unexpected character '='`)
+		})
+	})
+}
+
+var sampleCompose = `
+compose:
+  redis:
+    image: redis
+build:
+  image: golang
+  commands: [ go test ]
+`
+
+var sampleInvalid = `
+build:
+  backend:
+    commands: [ go test ]
+deploy:
+  heroku:
+    app: foo
+  octocat/heroku:
+    app: bar
+`
+
+func parseConfig(raw string) *yaml.Config {
+	conf, _ := yaml.ParseString(raw)
+	return conf
+}
+
+var sampleVersion2 = `
+version: 2
+pipeline:
+  - name: redis
+    type: service
+    image: redis
+  - name: test
+    image: golang
+    commands: [ go test ]
+  - name: slack
+    type: notify
+    image: slack
+    settings:
+      channel: dev
+`
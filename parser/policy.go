@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRegistry is the registry of images that do not
+// specify a registry hostname.
+const DefaultRegistry = "docker.io"
+
+// ImagePolicy defines the images that may be used by the
+// steps of a build.
+type ImagePolicy struct {
+	// Allow lists the patterns of plugin images that may be
+	// used. If empty, DefaultMatch is used.
+	Allow []string `json:"allow" yaml:"allow"`
+
+	// Deny lists the patterns of images that may not be used
+	// by any step.
+	Deny []string `json:"deny" yaml:"deny"`
+
+	// Registries lists the registries from which build and
+	// compose images may be pulled. If empty, images may be
+	// pulled from any registry.
+	Registries []string `json:"registries" yaml:"registries"`
+
+	// Digest requires publish and deploy plugin images to
+	// be pinned to a sha256 digest.
+	Digest bool `json:"require_digest" yaml:"require_digest"`
+}
+
+// ImagePolicyFunc returns a RuleFunc that checks the image
+// of each step against the policy.
+func ImagePolicyFunc(policy *ImagePolicy) RuleFunc {
+	return func(t *Tree, n Node) error {
+		d, ok := n.(*DockerNode)
+		if !ok || policy == nil {
+			return nil
+		}
+		return policy.Check(d)
+	}
+}
+
+// Check checks the image of the Docker Node against the
+// policy, returning an error describing the first violation.
+func (p *ImagePolicy) Check(d *DockerNode) error {
+	if len(d.Image) == 0 {
+		return nil
+	}
+	for _, pattern := range p.Deny {
+		if matchImage(pattern, d.Image) {
+			return fmt.Errorf("Image %s is denied by pattern %s", d.Image, pattern)
+		}
+	}
+
+	switch d.NodeType {
+	case NodeBuild, NodeCompose:
+		if len(p.Registries) == 0 {
+			return nil
+		}
+		registry := imageRegistry(d.Image)
+		for _, allowed := range p.Registries {
+			if registry == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("Image %s is not from an approved registry", d.Image)
+	}
+
+	if err := ImageMatch(d, p.Allow); err != nil {
+		return err
+	}
+
+	switch d.NodeType {
+	case NodePublish, NodeDeploy:
+		if p.Digest && !strings.Contains(d.Image, "@sha256:") {
+			return fmt.Errorf("Plugin %s must be pinned to a sha256 digest", d.Image)
+		}
+	}
+	return nil
+}
+
+// DefaultEscalate is the default escalation policy, granting
+// privileged mode to the official Docker publish plugins.
+var DefaultEscalate = &EscalatePolicy{
+	Images: []string{
+		"plugins/drone-docker",
+		"plugins/drone-gcr",
+	},
+}
+
+// EscalatePolicy defines the publish plugins that are granted
+// elevated privileges, and the privileges granted.
+type EscalatePolicy struct {
+	// Images lists the patterns of plugin images that are
+	// escalated. Patterns are matched with and without the
+	// image tag.
+	Images []string `json:"images" yaml:"images"`
+
+	// Label is the name of a trusted image label. Plugins
+	// whose image has the label set to true are escalated,
+	// if the image is from a registry listed in Registries
+	// or is pinned to a digest listed in Digests, since any
+	// image publisher can set the label.
+	Label      string   `json:"label" yaml:"label"`
+	Registries []string `json:"label_registries" yaml:"label_registries"`
+	Digests    []string `json:"label_digests" yaml:"label_digests"`
+
+	// CapAdd and Devices list the capabilities and devices
+	// granted to escalated plugins. If neither is set, the
+	// plugin is granted privileged mode.
+	CapAdd  []string `json:"cap_add" yaml:"cap_add"`
+	Devices []string `json:"devices" yaml:"devices"`
+}
+
+// Match returns true if the image matches the policy.
+func (p *EscalatePolicy) Match(image string) bool {
+	name := trimImageTag(image)
+	for _, pattern := range p.Images {
+		if matchImage(pattern, image) || matchImage(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustLabel returns true if the trusted label of the image
+// may be used to escalate the plugin.
+func (p *EscalatePolicy) TrustLabel(image string) bool {
+	if len(p.Label) == 0 {
+		return false
+	}
+	if i := strings.Index(image, "@"); i != -1 {
+		for _, digest := range p.Digests {
+			if image[i+1:] == digest {
+				return true
+			}
+		}
+	}
+	registry := imageRegistry(image)
+	for _, allowed := range p.Registries {
+		if registry == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply escalates the Docker Node, removing any configuration
+// options that could be used to abuse the elevated privileges.
+// Volumes added by the Mount and Cache rules are kept.
+func (p *EscalatePolicy) Apply(d *DockerNode) {
+	if len(p.CapAdd) == 0 && len(p.Devices) == 0 {
+		d.Privileged = true
+	} else {
+		d.CapAdd = append([]string(nil), p.CapAdd...)
+		d.Devices = append([]string(nil), p.Devices...)
+	}
+	d.Volumes = append([]string(nil), d.mounts...)
+	d.Net = ""
+	d.Entrypoint = []string{}
+}
+
+// SanitizePolicy defines the potentially harmful configuration
+// options that steps of untrusted repositories may use. Options
+// not allowed by the policy are removed.
+type SanitizePolicy struct {
+	// Volumes lists the host path prefixes that may be bound
+	// into containers. A prefix with the :ro suffix may only
+	// be bound in read-only mode.
+	Volumes []string `json:"volumes" yaml:"volumes"`
+
+	// Net lists the network modes that may be used.
+	Net []string `json:"net" yaml:"net"`
+
+	// Entrypoints lists the entrypoints that may be used,
+	// each written as a space separated command.
+	Entrypoints []string `json:"entrypoints" yaml:"entrypoints"`
+
+	// CapAdd lists the capabilities that may be added.
+	CapAdd []string `json:"cap_add" yaml:"cap_add"`
+
+	// Devices lists the host devices that may be mapped
+	// into containers.
+	Devices []string `json:"devices" yaml:"devices"`
+
+	// CapDrop lists the capabilities that may be dropped.
+	CapDrop []string `json:"cap_drop" yaml:"cap_drop"`
+
+	// Users lists the users that containers may run as.
+	Users []string `json:"users" yaml:"users"`
+
+	// Hostnames lists the hostnames that may be used.
+	Hostnames []string `json:"hostnames" yaml:"hostnames"`
+
+	// DNS lists the DNS servers that may be used.
+	DNS []string `json:"dns" yaml:"dns"`
+
+	// DNSSearch lists the DNS search domains that may be used.
+	DNSSearch []string `json:"dns_search" yaml:"dns_search"`
+
+	// Tmpfs lists the container paths where tmpfs may be
+	// mounted.
+	Tmpfs []string `json:"tmpfs" yaml:"tmpfs"`
+}
+
+// Apply removes the configuration options of the Docker Node not
+// allowed by the policy, and returns a description of each option
+// removed.
+func (p *SanitizePolicy) Apply(d *DockerNode) []string {
+	var removed []string
+	if d.Privileged {
+		d.Privileged = false
+		removed = append(removed, "privileged")
+	}
+
+	var volumes []string
+	for _, volume := range d.Volumes {
+		if p.allowVolume(volume) {
+			volumes = append(volumes, volume)
+		} else {
+			removed = append(removed, "volume "+volume)
+		}
+	}
+	d.Volumes = volumes
+
+	if len(d.Net) != 0 && !contains(p.Net, d.Net) {
+		removed = append(removed, "net "+d.Net)
+		d.Net = ""
+	}
+
+	entrypoint := strings.Join(d.Entrypoint, " ")
+	if len(entrypoint) != 0 && !contains(p.Entrypoints, entrypoint) {
+		removed = append(removed, "entrypoint "+entrypoint)
+		d.Entrypoint = []string{}
+	}
+
+	d.CapAdd = allow(p.CapAdd, d.CapAdd, "cap_add", &removed)
+	d.CapDrop = allow(p.CapDrop, d.CapDrop, "cap_drop", &removed)
+	d.Devices = allow(p.Devices, d.Devices, "device", &removed)
+	d.DNS = allow(p.DNS, d.DNS, "dns", &removed)
+	d.DNSSearch = allow(p.DNSSearch, d.DNSSearch, "dns_search", &removed)
+	d.Tmpfs = allow(p.Tmpfs, d.Tmpfs, "tmpfs", &removed)
+
+	if len(d.User) != 0 && !contains(p.Users, d.User) {
+		removed = append(removed, "user "+d.User)
+		d.User = ""
+	}
+	if len(d.Hostname) != 0 && !contains(p.Hostnames, d.Hostname) {
+		removed = append(removed, "hostname "+d.Hostname)
+		d.Hostname = ""
+	}
+
+	// the working directory must be in the workspace.
+	if len(d.WorkingDir) != 0 && !inWorkspace(d.WorkingDir) {
+		removed = append(removed, "working_dir "+d.WorkingDir)
+		d.WorkingDir = ""
+	}
+	return removed
+}
+
+// allow is a helper function that returns the values allowed
+// by the list, appending the others to removed. Devices and
+// tmpfs mounts are allowed by the path before the colon.
+func allow(list, values []string, option string, removed *[]string) []string {
+	var allowed []string
+	for _, value := range values {
+		if contains(list, value) || contains(list, strings.SplitN(value, ":", 2)[0]) {
+			allowed = append(allowed, value)
+		} else {
+			*removed = append(*removed, option+" "+value)
+		}
+	}
+	return allowed
+}
+
+// inWorkspace is a helper function that returns true if the
+// path is relative, and does not leave the workspace.
+func inWorkspace(dir string) bool {
+	dir = path.Clean(dir)
+	return !path.IsAbs(dir) && dir != ".." && !strings.HasPrefix(dir, "../")
+}
+
+// allowVolume is a helper function that returns true if the
+// volume is a bind mount of a host path allowed by the policy.
+func (p *SanitizePolicy) allowVolume(volume string) bool {
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 {
+		return false
+	}
+	host := filepath.Clean(parts[0])
+	readonly := len(parts) > 2 && contains(strings.Split(parts[2], ","), "ro")
+
+	for _, prefix := range p.Volumes {
+		if strings.HasSuffix(prefix, ":ro") {
+			if !readonly {
+				continue
+			}
+			prefix = strings.TrimSuffix(prefix, ":ro")
+		}
+		prefix = filepath.Clean(prefix)
+		if prefix == "/" || host == prefix || strings.HasPrefix(host, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchImage is a helper function that returns true if the
+// image matches the glob pattern.
+func matchImage(pattern, image string) bool {
+	if pattern == image {
+		return true
+	}
+	ok, err := filepath.Match(pattern, image)
+	return ok && err == nil
+}
+
+// imageRegistry is a helper function that returns the
+// registry hostname of the image. The first component of
+// the image name is a registry if it contains a dot or port,
+// or is localhost.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return DefaultRegistry
+	}
+	host := parts[0]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+	return DefaultRegistry
+}
+
+// trimImageTag is a helper function that returns the image
+// name without the tag or digest.
+func trimImageTag(image string) string {
+	if n := strings.Index(image, "@"); n >= 0 {
+		image = image[:n]
+	}
+	n := strings.LastIndex(image, ":")
+	if n >= 0 && !strings.Contains(image[n+1:], "/") {
+		image = image[:n]
+	}
+	return image
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
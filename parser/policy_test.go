@@ -0,0 +1,258 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestImagePolicy(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Image policy", func() {
+
+		policy := &ImagePolicy{
+			Allow:      []string{"plugins/*", "octocat/*"},
+			Deny:       []string{"plugins/drone-ssh:*"},
+			Registries: []string{"docker.io", "registry.example.com"},
+			Digest:     true,
+		}
+
+		g.It("Should deny images matching a deny pattern", func() {
+			n := &DockerNode{NodeType: NodeNotify, Image: "plugins/drone-ssh:latest"}
+			g.Assert(policy.Check(n).Error()).Equal("Image plugins/drone-ssh:latest is denied by pattern plugins/drone-ssh:*")
+		})
+
+		g.It("Should allow whitelisted plugins", func() {
+			n := &DockerNode{NodeType: NodeNotify, Image: "octocat/drone-slack:latest"}
+			g.Assert(policy.Check(n) == nil).IsTrue()
+		})
+
+		g.It("Should reject plugins not in the whitelist", func() {
+			n := &DockerNode{NodeType: NodeNotify, Image: "hacker/drone-slack:latest"}
+			g.Assert(policy.Check(n) == nil).IsFalse()
+		})
+
+		g.It("Should restrict build images to approved registries", func() {
+			n := &DockerNode{NodeType: NodeBuild, Image: "golang:1.5"}
+			g.Assert(policy.Check(n) == nil).IsTrue()
+			n = &DockerNode{NodeType: NodeCompose, Image: "registry.example.com/redis:latest"}
+			g.Assert(policy.Check(n) == nil).IsTrue()
+			n = &DockerNode{NodeType: NodeCompose, Image: "quay.io/coreos/etcd:latest"}
+			g.Assert(policy.Check(n).Error()).Equal("Image quay.io/coreos/etcd:latest is not from an approved registry")
+		})
+
+		g.It("Should require digests for publish and deploy plugins", func() {
+			n := &DockerNode{NodeType: NodePublish, Image: "plugins/drone-docker:latest"}
+			g.Assert(policy.Check(n).Error()).Equal("Plugin plugins/drone-docker:latest must be pinned to a sha256 digest")
+			n = &DockerNode{NodeType: NodeDeploy, Image: "plugins/drone-heroku@sha256:3f9db97f8568"}
+			g.Assert(policy.Check(n) == nil).IsTrue()
+			n = &DockerNode{NodeType: NodeNotify, Image: "plugins/drone-slack:latest"}
+			g.Assert(policy.Check(n) == nil).IsTrue()
+		})
+
+		g.It("Should parse the registry of an image", func() {
+			g.Assert(imageRegistry("golang")).Equal("docker.io")
+			g.Assert(imageRegistry("library/golang:1.5")).Equal("docker.io")
+			g.Assert(imageRegistry("localhost/golang")).Equal("localhost")
+			g.Assert(imageRegistry("localhost:5000/golang")).Equal("localhost:5000")
+			g.Assert(imageRegistry("gcr.io/google/golang")).Equal("gcr.io")
+		})
+	})
+
+	g.Describe("Escalation policy", func() {
+
+		g.It("Should escalate the default plugins to privileged mode", func() {
+			n := &DockerNode{NodeType: NodePublish, Image: "plugins/drone-docker:latest", Volumes: []string{"/:/host"}}
+			Escalate(nil, n)
+			g.Assert(n.Privileged).IsTrue()
+			g.Assert(len(n.Volumes)).Equal(0)
+		})
+
+		g.It("Should only escalate publish plugins", func() {
+			n := &DockerNode{NodeType: NodeDeploy, Image: "plugins/drone-docker:latest"}
+			Escalate(nil, n)
+			g.Assert(n.Privileged).IsFalse()
+		})
+
+		g.It("Should escalate configured plugins with capabilities", func() {
+			policy := &EscalatePolicy{
+				Images:  []string{"octocat/drone-*"},
+				CapAdd:  []string{"SYS_ADMIN"},
+				Devices: []string{"/dev/fuse"},
+			}
+			n := &DockerNode{NodeType: NodePublish, Image: "octocat/drone-docker@sha256:3f9db97f8568"}
+			EscalateFunc(policy)(nil, n)
+			g.Assert(n.Privileged).IsFalse()
+			g.Assert(n.CapAdd).Equal([]string{"SYS_ADMIN"})
+			g.Assert(n.Devices).Equal([]string{"/dev/fuse"})
+
+			n = &DockerNode{NodeType: NodePublish, Image: "plugins/drone-docker:latest"}
+			EscalateFunc(policy)(nil, n)
+			g.Assert(n.Privileged).IsFalse()
+			g.Assert(len(n.CapAdd)).Equal(0)
+		})
+
+		g.It("Should not share the granted capabilities between steps", func() {
+			policy := &EscalatePolicy{Images: []string{"octocat/*"}, CapAdd: []string{"SYS_ADMIN"}}
+			a := &DockerNode{NodeType: NodePublish, Image: "octocat/drone-docker"}
+			b := &DockerNode{NodeType: NodePublish, Image: "octocat/drone-gcr"}
+			EscalateFunc(policy)(nil, a)
+			EscalateFunc(policy)(nil, b)
+			a.CapAdd[0] = "NET_ADMIN"
+			g.Assert(b.CapAdd).Equal([]string{"SYS_ADMIN"})
+			g.Assert(policy.CapAdd).Equal([]string{"SYS_ADMIN"})
+		})
+
+		g.It("Should keep mounted volumes when escalating", func() {
+			n := &DockerNode{NodeType: NodePublish, Image: "plugins/drone-docker", Volumes: []string{"/etc:/etc"}}
+			Mount(n, "/home/octocat/hello-world", "/drone/src")
+			(&EscalatePolicy{}).Apply(n)
+			g.Assert(n.Privileged).IsTrue()
+			g.Assert(n.Volumes).Equal([]string{"/home/octocat/hello-world:/drone/src"})
+		})
+
+		g.It("Should only trust the label of listed registries and digests", func() {
+			policy := &EscalatePolicy{
+				Label:      "io.drone.escalate",
+				Registries: []string{"registry.example.com"},
+				Digests:    []string{"sha256:3f9db97f8568"},
+			}
+			g.Assert(policy.TrustLabel("registry.example.com/drone-docker")).IsTrue()
+			g.Assert(policy.TrustLabel("octocat/drone-docker@sha256:3f9db97f8568")).IsTrue()
+			g.Assert(policy.TrustLabel("octocat/drone-docker")).IsFalse()
+			g.Assert(policy.TrustLabel("octocat/drone-docker@sha256:0000")).IsFalse()
+			g.Assert((&EscalatePolicy{Registries: []string{"docker.io"}}).TrustLabel("octocat/drone-docker")).IsFalse()
+		})
+
+		g.It("Should trim the image tag and digest", func() {
+			g.Assert(trimImageTag("plugins/drone-docker:latest")).Equal("plugins/drone-docker")
+			g.Assert(trimImageTag("localhost:5000/drone-docker")).Equal("localhost:5000/drone-docker")
+			g.Assert(trimImageTag("drone-docker@sha256:3f9db97f8568")).Equal("drone-docker")
+		})
+	})
+
+	g.Describe("Sanitize policy", func() {
+
+		g.It("Should remove all options by default", func() {
+			n := &DockerNode{
+				Privileged: true,
+				Volumes:    []string{"/var/cache:/cache"},
+				Net:        "host",
+				Entrypoint: []string{"/bin/sh"},
+			}
+			Sanitize(nil, n)
+			g.Assert(n.Privileged).IsFalse()
+			g.Assert(len(n.Volumes)).Equal(0)
+			g.Assert(n.Net).Equal("")
+			g.Assert(len(n.Entrypoint)).Equal(0)
+		})
+
+		g.It("Should not sanitize trusted repositories", func() {
+			n := &DockerNode{Privileged: true}
+			SanitizeFunc(true)(nil, n)
+			g.Assert(n.Privileged).IsTrue()
+		})
+
+		g.It("Should keep options allowed by the policy", func() {
+			policy := &SanitizePolicy{
+				Volumes:     []string{"/var/lib/tools:ro", "/tmp/shared"},
+				Net:         []string{"bridge"},
+				Entrypoints: []string{"/bin/sh -c"},
+			}
+			n := &DockerNode{
+				Volumes: []string{
+					"/var/lib/tools/go:/go:ro",
+					"/var/lib/tools:/tools",
+					"/var/lib/tools/../../../etc:/etc:ro",
+					"/tmp/shared/foo:/foo",
+					"/tmp/sharedfoo:/foo",
+				},
+				Net:        "bridge",
+				Entrypoint: []string{"/bin/sh", "-c"},
+			}
+			removed := policy.Apply(n)
+			g.Assert(n.Volumes).Equal([]string{"/var/lib/tools/go:/go:ro", "/tmp/shared/foo:/foo"})
+			g.Assert(n.Net).Equal("bridge")
+			g.Assert(n.Entrypoint).Equal([]string{"/bin/sh", "-c"})
+			g.Assert(removed).Equal([]string{
+				"volume /var/lib/tools:/tools",
+				"volume /var/lib/tools/../../../etc:/etc:ro",
+				"volume /tmp/sharedfoo:/foo",
+			})
+		})
+
+		g.It("Should remove capabilities and devices not allowed", func() {
+			policy := &SanitizePolicy{
+				CapAdd:  []string{"SYS_PTRACE"},
+				Devices: []string{"/dev/fuse"},
+			}
+			n := &DockerNode{
+				CapAdd:  []string{"SYS_PTRACE", "SYS_ADMIN"},
+				CapDrop: []string{"MKNOD"},
+				Devices: []string{"/dev/fuse", "/dev/sda:/dev/xvda"},
+				User:    "root",
+			}
+			removed := policy.Apply(n)
+			g.Assert(n.CapAdd).Equal([]string{"SYS_PTRACE"})
+			g.Assert(len(n.CapDrop)).Equal(0)
+			g.Assert(n.Devices).Equal([]string{"/dev/fuse"})
+			g.Assert(n.User).Equal("")
+			g.Assert(removed).Equal([]string{"cap_add SYS_ADMIN", "cap_drop MKNOD", "device /dev/sda:/dev/xvda", "user root"})
+		})
+
+		g.It("Should remove container options not allowed", func() {
+			n := &DockerNode{
+				User:      "root",
+				Hostname:  "builder",
+				DNS:       []string{"8.8.8.8"},
+				DNSSearch: []string{"example.com"},
+				Tmpfs:     []string{"/run"},
+			}
+			Sanitize(nil, n)
+			g.Assert(n.User).Equal("")
+			g.Assert(n.Hostname).Equal("")
+			g.Assert(len(n.DNS)).Equal(0)
+			g.Assert(len(n.DNSSearch)).Equal(0)
+			g.Assert(len(n.Tmpfs)).Equal(0)
+		})
+
+		g.It("Should keep container options allowed by the policy", func() {
+			policy := &SanitizePolicy{
+				CapDrop:   []string{"MKNOD"},
+				Users:     []string{"nobody"},
+				Hostnames: []string{"builder"},
+				DNS:       []string{"8.8.8.8", "2001:4860:4860::8888"},
+				DNSSearch: []string{"example.com"},
+				Tmpfs:     []string{"/tmp"},
+			}
+			n := &DockerNode{
+				CapDrop:   []string{"MKNOD", "NET_RAW"},
+				User:      "nobody",
+				Hostname:  "builder",
+				DNS:       []string{"8.8.8.8", "2001:4860:4860::8888", "1.1.1.1"},
+				DNSSearch: []string{"example.com"},
+				Tmpfs:     []string{"/tmp:size=64m", "/run"},
+			}
+			removed := policy.Apply(n)
+			g.Assert(n.CapDrop).Equal([]string{"MKNOD"})
+			g.Assert(n.User).Equal("nobody")
+			g.Assert(n.Hostname).Equal("builder")
+			g.Assert(n.DNS).Equal([]string{"8.8.8.8", "2001:4860:4860::8888"})
+			g.Assert(n.DNSSearch).Equal([]string{"example.com"})
+			g.Assert(n.Tmpfs).Equal([]string{"/tmp:size=64m"})
+			g.Assert(removed).Equal([]string{"cap_drop NET_RAW", "dns 1.1.1.1", "tmpfs /run"})
+		})
+
+		g.It("Should remove working directories outside the workspace", func() {
+			for _, dir := range []string{"/etc", "..", "web/../../.."} {
+				n := &DockerNode{WorkingDir: dir}
+				Sanitize(nil, n)
+				g.Assert(n.WorkingDir).Equal("")
+			}
+			n := &DockerNode{WorkingDir: "web/../api"}
+			Sanitize(nil, n)
+			g.Assert(n.WorkingDir).Equal("web/../api")
+		})
+	})
+}
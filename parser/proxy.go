@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"os"
+	"strings"
+)
+
+// ambassadorHosts defines the hosts of the ambassador
+// container. Steps and services share the ambassador's
+// network namespace, and reach each other on localhost.
+var ambassadorHosts = []string{"localhost", "127.0.0.1"}
+
+// ProxyConfig defines the proxy settings injected into the
+// environment of each step.
+type ProxyConfig struct {
+	HTTP    string `json:"http_proxy" yaml:"http_proxy"`
+	HTTPS   string `json:"https_proxy" yaml:"https_proxy"`
+	NoProxy string `json:"no_proxy" yaml:"no_proxy"`
+}
+
+// ProxyFromEnvironment returns the proxy settings of the
+// current process, preferring the uppercase variables.
+func ProxyFromEnvironment() *ProxyConfig {
+	return &ProxyConfig{
+		HTTP:    getenv("HTTP_PROXY", "http_proxy"),
+		HTTPS:   getenv("HTTPS_PROXY", "https_proxy"),
+		NoProxy: getenv("NO_PROXY", "no_proxy"),
+	}
+}
+
+// ProxyFunc returns a RuleFunc that injects the proxy
+// settings into the environment of each step, in both
+// uppercase and lowercase. The compose service names and
+// the ambassador are appended to NO_PROXY. Steps with the
+// proxy disabled are ignored.
+func ProxyFunc(conf *ProxyConfig) RuleFunc {
+	if conf == nil {
+		conf = ProxyFromEnvironment()
+	}
+	return func(t *Tree, n Node) error {
+		d, ok := n.(*DockerNode)
+		if !ok || !d.Proxy {
+			return nil
+		}
+		if len(conf.HTTP) == 0 && len(conf.HTTPS) == 0 {
+			return nil
+		}
+		noproxy := strings.Join(noProxyHosts(conf.NoProxy, t), ",")
+
+		var env []string
+		if len(conf.HTTP) != 0 {
+			env = append(env, "HTTP_PROXY="+conf.HTTP, "http_proxy="+conf.HTTP)
+		}
+		if len(conf.HTTPS) != 0 {
+			env = append(env, "HTTPS_PROXY="+conf.HTTPS, "https_proxy="+conf.HTTPS)
+		}
+		env = append(env, "NO_PROXY="+noproxy, "no_proxy="+noproxy)
+
+		// the proxy variables are prepended so that the
+		// step environment takes precedence.
+		d.Environment = append(env, d.Environment...)
+		return nil
+	}
+}
+
+// noProxyHosts is a helper function that returns the hosts
+// excluded from the proxy, followed by the ambassador and
+// compose service names, without duplicates.
+func noProxyHosts(noproxy string, tree *Tree) []string {
+	var hosts []string
+	add := func(host string) {
+		host = strings.TrimSpace(host)
+		if len(host) != 0 && !contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, host := range strings.Split(noproxy, ",") {
+		add(host)
+	}
+	for _, host := range ambassadorHosts {
+		add(host)
+	}
+	if tree == nil {
+		return hosts
+	}
+	for _, node := range tree.Root.Nodes {
+		if f, ok := node.(*FilterNode); ok {
+			node = f.Node
+		}
+		d, ok := node.(*DockerNode)
+		if !ok || d.NodeType != NodeCompose {
+			continue
+		}
+		add(d.Name)
+	}
+	return hosts
+}
+
+// getenv is a helper function that returns the value of
+// the first environment variable that is set.
+func getenv(keys ...string) string {
+	for _, key := range keys {
+		if val := os.Getenv(key); len(val) != 0 {
+			return val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/drone/drone-exec/yaml"
+	"github.com/franela/goblin"
+)
+
+func TestProxy(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Proxy rule", func() {
+
+		conf := &ProxyConfig{
+			HTTP:    "http://proxy:3128",
+			HTTPS:   "http://proxy:3129",
+			NoProxy: "example.com",
+		}
+
+		g.It("Should inject uppercase and lowercase variables", func() {
+			n := &DockerNode{Proxy: true, Environment: []string{"FOO=bar"}}
+			ProxyFunc(conf)(nil, n)
+			g.Assert(n.Environment).Equal([]string{
+				"HTTP_PROXY=http://proxy:3128",
+				"http_proxy=http://proxy:3128",
+				"HTTPS_PROXY=http://proxy:3129",
+				"https_proxy=http://proxy:3129",
+				"NO_PROXY=example.com,localhost,127.0.0.1",
+				"no_proxy=example.com,localhost,127.0.0.1",
+				"FOO=bar",
+			})
+		})
+
+		g.It("Should ignore steps with the proxy disabled", func() {
+			n := &DockerNode{Proxy: false}
+			ProxyFunc(conf)(nil, n)
+			g.Assert(len(n.Environment)).Equal(0)
+		})
+
+		g.It("Should ignore an empty proxy configuration", func() {
+			n := &DockerNode{Proxy: true}
+			ProxyFunc(&ProxyConfig{NoProxy: "example.com"})(nil, n)
+			g.Assert(len(n.Environment)).Equal(0)
+		})
+
+		g.It("Should exclude compose services when applied to the tree", func() {
+			tree, err := Parse(sampleProxyYaml, []RuleFunc{ProxyFunc(conf)})
+			g.Assert(err == nil).IsTrue()
+			redis := tree.Root.Nodes[1].(*FilterNode).Node.(*DockerNode)
+			g.Assert(redis.Environment[4]).Equal("NO_PROXY=example.com,localhost,127.0.0.1,redis,mysql")
+		})
+
+		g.It("Should share the rule across trees", func() {
+			rule := ProxyFunc(conf)
+			_, err := Parse(sampleProxyYaml, []RuleFunc{rule})
+			g.Assert(err == nil).IsTrue()
+			tree, err := Parse("build:\n  image: golang\ncompose:\n  postgres:\n    image: postgres\n", []RuleFunc{rule})
+			g.Assert(err == nil).IsTrue()
+			postgres := tree.Root.Nodes[1].(*FilterNode).Node.(*DockerNode)
+			g.Assert(postgres.Environment[4]).Equal("NO_PROXY=example.com,localhost,127.0.0.1,postgres")
+		})
+
+		g.It("Should exclude compose services from the proxy", func() {
+			conf, err := yaml.ParseString(sampleProxyYaml)
+			g.Assert(err == nil).IsTrue()
+			tree := New(conf)
+			g.Assert(noProxyHosts("example.com, localhost", tree)).Equal([]string{
+				"example.com", "localhost", "127.0.0.1", "redis", "mysql",
+			})
+			mysql := tree.Root.Nodes[2].(*FilterNode).Node.(*DockerNode)
+			g.Assert(mysql.Name).Equal("mysql")
+			g.Assert(mysql.Proxy).IsFalse()
+		})
+	})
+}
+
+var sampleProxyYaml = `
+build:
+  image: golang
+  commands:
+    - go test
+compose:
+  redis:
+    image: redis:2.8
+  mysql:
+    image: mysql
+    proxy: false
+`
@@ -0,0 +1,72 @@
+package parser
+
+// A Visitor's Visit method is invoked for each node
+// encountered by Walk. If the result visitor w is not nil,
+// Walk visits each of the children of node with the visitor
+// w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order. It starts
+// by calling v.Visit(node); node must not be nil. If the
+// visitor w returned by v.Visit(node) is not nil, Walk is
+// invoked recursively with visitor w for each of the non-nil
+// children of node, followed by a call of w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *ListNode:
+		for _, child := range n.Nodes {
+			Walk(v, child)
+		}
+	case *FilterNode:
+		if n.Node != nil {
+			Walk(v, n.Node)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order. It starts
+// by calling f(node); node must not be nil. If f returns true,
+// Inspect invokes f recursively for each of the non-nil
+// children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// RuleVisitor is implemented by rules that handle the
+// DockerNode and FilterNode of each step, without having to
+// type switch on the node.
+type RuleVisitor interface {
+	VisitDocker(*DockerNode) error
+	VisitFilter(*FilterNode) error
+}
+
+// VisitorFunc returns a RuleFunc that dispatches each node
+// to the matching method of the RuleVisitor.
+func VisitorFunc(v RuleVisitor) RuleFunc {
+	return func(t *Tree, n Node) error {
+		switch node := n.(type) {
+		case *DockerNode:
+			return v.VisitDocker(node)
+		case *FilterNode:
+			return v.VisitFilter(node)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-exec/yaml"
+	"github.com/franela/goblin"
+)
+
+func TestWalk(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Tree walking", func() {
+
+		g.It("Should inspect nodes in depth-first order", func() {
+			tree, err := Parse(sampleWalkYaml, nil)
+			g.Assert(err == nil).IsTrue()
+
+			var types []NodeType
+			Inspect(tree.Root, func(n Node) bool {
+				if n != nil {
+					types = append(types, n.Type())
+				}
+				return true
+			})
+			g.Assert(types).Equal([]NodeType{
+				NodeList,
+				NodeFilter, NodeClone,
+				NodeFilter, NodeCompose,
+				NodeFilter, NodeBuild,
+				NodeFilter, NodeNotify,
+			})
+		})
+
+		g.It("Should not walk children when the visitor returns nil", func() {
+			tree, _ := Parse(sampleWalkYaml, nil)
+			var count int
+			Inspect(tree.Root, func(n Node) bool {
+				if n == nil {
+					return false
+				}
+				count++
+				return n.Type() == NodeList
+			})
+			g.Assert(count).Equal(5) // the list and four filters
+		})
+
+		g.It("Should dispatch rules to the visitor", func() {
+			v := &countVisitor{}
+			tree, err := Parse(sampleWalkYaml, []RuleFunc{VisitorFunc(v)})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(tree == nil).IsFalse()
+			g.Assert(v.docker).Equal(4)
+			g.Assert(v.filter).Equal(4)
+		})
+	})
+
+	g.Describe("Tree marshalling", func() {
+
+		g.It("Should render the tree as Yaml", func() {
+			tree, err := Parse(sampleWalkYaml, []RuleFunc{ImageName})
+			g.Assert(err == nil).IsTrue()
+			out, err := Marshal(tree)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(sampleWalkOutput)
+		})
+
+		g.It("Should parse the rendered Yaml", func() {
+			tree, _ := Parse(sampleWalkYaml, []RuleFunc{ImageName})
+			out, _ := Marshal(tree)
+			conf, err := yaml.Parse(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Slice()[0].Commands).Equal([]string{"go build", "go test"})
+			g.Assert(conf.Notify.Slice()[0].Vargs["channel"]).Equal("dev")
+		})
+
+		g.It("Should render version 2 trees as a pipeline", func() {
+			tree, err := Parse(samplePipelineYaml, []RuleFunc{ImageName})
+			g.Assert(err == nil).IsTrue()
+			out, err := Marshal(tree)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(samplePipelineOutput)
+
+			conf, err := yaml.Parse(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(conf.Pipeline.Slice())).Equal(3)
+		})
+
+		g.It("Should not render registry passwords", func() {
+			tree, _ := Parse("build:\n  image: golang\n  auth_config:\n    username: octocat\n    password: hunter2\n    registry_token: secret\n", nil)
+			out, _ := Marshal(tree)
+			g.Assert(strings.Contains(string(out), "octocat")).IsTrue()
+			g.Assert(strings.Contains(string(out), "hunter2")).IsFalse()
+			g.Assert(strings.Contains(string(out), "secret")).IsFalse()
+		})
+	})
+}
+
+type countVisitor struct {
+	docker int
+	filter int
+}
+
+func (v *countVisitor) VisitDocker(*DockerNode) error {
+	v.docker++
+	return nil
+}
+
+func (v *countVisitor) VisitFilter(*FilterNode) error {
+	v.filter++
+	return nil
+}
+
+var sampleWalkYaml = `
+build:
+  image: golang
+  commands:
+    - go build
+    - go test
+compose:
+  redis:
+    image: redis:2.8
+notify:
+  slack:
+    channel: dev
+    when:
+      branch: master
+`
+
+var sampleWalkOutput = `clone:
+  image: plugins/drone-git:latest
+compose:
+  redis:
+    image: redis:2.8
+build:
+  image: golang:latest
+  commands:
+  - go build
+  - go test
+notify:
+  slack:
+    image: plugins/drone-slack:latest
+    channel: dev
+    when:
+      branch:
+      - master
+`
+
+var samplePipelineYaml = `
+version: 2
+pipeline:
+  - name: test
+    image: golang
+    commands: [ go test ]
+  - name: slack
+    type: notify
+    image: plugins/slack
+    settings:
+      channel: dev
+    when:
+      branch: master
+`
+
+var samplePipelineOutput = `version: 2
+pipeline:
+- name: git
+  type: clone
+  image: plugins/drone-git:latest
+- name: test
+  type: build
+  image: golang:latest
+  commands:
+  - go test
+- name: slack
+  type: notify
+  image: plugins/slack:latest
+  settings:
+    channel: dev
+  when:
+    branch:
+    - master
+`
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/drone/drone-exec/runner"
+)
+
+// junitSuites is the root element of a JUnit report.
+type junitSuites struct {
+	XMLName xml.Name      `xml:"testsuites"`
+	Suites  []*junitSuite `xml:"testsuite"`
+}
+
+// junitSuite represents a section of the build, such
+// as the build or publish section.
+type junitSuite struct {
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+
+	duration time.Duration
+}
+
+// junitCase represents a single step of the build.
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Output  string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// JUnit writes the executed steps as a JUnit XML report
+// with one test suite per section and one test case per
+// step, in order of execution. Suites of named pipelines
+// are prefixed with the pipeline name.
+func JUnit(w io.Writer, steps []*runner.Step) error {
+	var root junitSuites
+	var suites = map[string]*junitSuite{}
+
+	for _, step := range steps {
+		name := step.Section()
+		if len(step.Pipeline) != 0 {
+			name = step.Pipeline + "/" + name
+		}
+		suite, ok := suites[name]
+		if !ok {
+			suite = &junitSuite{Name: name}
+			suites[name] = suite
+			root.Suites = append(root.Suites, suite)
+		}
+
+		tc := &junitCase{
+			Name:      step.Name(),
+			Classname: name,
+			Time:      seconds(step.Duration()),
+		}
+		switch {
+		case step.Skipped:
+			tc.Skipped = &junitSkipped{Message: step.Reason}
+			suite.Skipped++
+		case step.ExitCode != 0:
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("exit code %d", step.ExitCode),
+				Type:    "failure",
+				Output:  step.Output(),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.duration += step.Duration()
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, suite := range root.Suites {
+		suite.Time = seconds(suite.duration)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds is a helper function that formats the duration
+// in seconds, as expected by JUnit consumers.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
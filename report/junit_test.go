@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-exec/runner"
+	"github.com/franela/goblin"
+)
+
+func TestJUnit(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("JUnit report", func() {
+
+		steps := []*runner.Step{
+			{Node: &parser.DockerNode{NodeType: parser.NodeClone, Image: "plugins/drone-git:latest"}},
+			{Node: &parser.DockerNode{NodeType: parser.NodeBuild, Name: "backend", Image: "golang:1.5"}, ExitCode: 2},
+			{Node: &parser.DockerNode{NodeType: parser.NodeBuild, Image: "node:5"}, Skipped: true, Reason: "previous step failed"},
+			{Node: &parser.DockerNode{NodeType: parser.NodeDeploy, Image: "plugins/drone-heroku:latest"}, Skipped: true, Reason: "branch: master"},
+		}
+
+		var buf bytes.Buffer
+		err := JUnit(&buf, steps)
+
+		out := junitSuites{}
+		xml.Unmarshal(buf.Bytes(), &out)
+
+		g.It("Should write the report", func() {
+			g.Assert(err == nil).IsTrue()
+		})
+
+		g.It("Should group steps by section", func() {
+			g.Assert(len(out.Suites)).Equal(3)
+			g.Assert(out.Suites[0].Name).Equal("clone")
+			g.Assert(out.Suites[1].Name).Equal("build")
+			g.Assert(out.Suites[2].Name).Equal("deploy")
+			g.Assert(out.Suites[1].Tests).Equal(2)
+		})
+
+		g.It("Should name test cases by step name", func() {
+			g.Assert(out.Suites[0].Cases[0].Name).Equal("plugins/drone-git:latest")
+			g.Assert(out.Suites[1].Cases[0].Name).Equal("backend")
+		})
+
+		g.It("Should report failures with the exit code", func() {
+			g.Assert(out.Suites[1].Failures).Equal(1)
+			g.Assert(out.Suites[1].Cases[0].Failure.Message).Equal("exit code 2")
+		})
+
+		g.It("Should report skipped steps with the condition", func() {
+			g.Assert(out.Suites[1].Skipped).Equal(1)
+			g.Assert(out.Suites[2].Cases[0].Skipped.Message).Equal("branch: master")
+		})
+
+		g.It("Should prefix suites with the pipeline name", func() {
+			var buf bytes.Buffer
+			JUnit(&buf, []*runner.Step{
+				{Node: &parser.DockerNode{NodeType: parser.NodeBuild, Image: "golang:1.5"}, Pipeline: "backend"},
+				{Node: &parser.DockerNode{NodeType: parser.NodeBuild, Image: "node:5"}, Pipeline: "docs"},
+			})
+			out := junitSuites{}
+			xml.Unmarshal(buf.Bytes(), &out)
+			g.Assert(len(out.Suites)).Equal(2)
+			g.Assert(out.Suites[0].Name).Equal("backend/build")
+			g.Assert(out.Suites[1].Name).Equal("docs/build")
+		})
+	})
+}
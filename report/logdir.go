@@ -0,0 +1,110 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/drone/drone-exec/runner"
+)
+
+// IndexFile is the name of the index file written to the
+// log directory.
+const IndexFile = "index.json"
+
+var unsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// LogDir writes the output of each step to its own file
+// in a directory on the host machine.
+type LogDir struct {
+	sync.Mutex
+
+	Dir string
+
+	opened map[string]bool
+}
+
+// NewLogDir returns a LogDir writing to the directory,
+// creating the directory if it does not exist.
+func NewLogDir(dir string) (*LogDir, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &LogDir{Dir: dir, opened: map[string]bool{}}, nil
+}
+
+// Open opens the log file for the step. A step that runs
+// more than once, such as the cache step, is appended to
+// the same log file.
+func (l *LogDir) Open(step *runner.Step) (io.WriteCloser, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	name := filepath.Join(l.Dir, LogName(step))
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if l.opened[name] {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.opened[name] = true
+	return f, nil
+}
+
+// WriteIndex writes an index of the steps, and their log
+// files, to the log directory.
+func (l *LogDir) WriteIndex(steps []*runner.Step) error {
+	entries := []*indexEntry{}
+	for _, step := range steps {
+		entry := &indexEntry{
+			Section:  step.Section(),
+			Index:    step.Index,
+			Name:     step.Name(),
+			Image:    step.Node.Image,
+			ExitCode: step.ExitCode,
+			Skipped:  step.Skipped,
+			Reason:   step.Reason,
+			Duration: step.Duration().Seconds(),
+		}
+		if step.Logged {
+			entry.File = LogName(step)
+		}
+		entries = append(entries, entry)
+	}
+
+	f, err := os.Create(filepath.Join(l.Dir, IndexFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	return enc.Encode(entries)
+}
+
+// LogName returns the name of the log file for the step,
+// derived from the section, index and name of the step.
+func LogName(step *runner.Step) string {
+	name := unsafeRegexp.ReplaceAllString(step.Name(), "_")
+	return fmt.Sprintf("%s-%02d-%s.log", step.Section(), step.Index, name)
+}
+
+// indexEntry represents a single step in the index file.
+type indexEntry struct {
+	Section  string  `json:"section"`
+	Index    int     `json:"index"`
+	Name     string  `json:"name"`
+	Image    string  `json:"image"`
+	File     string  `json:"file,omitempty"`
+	ExitCode int     `json:"exit_code"`
+	Skipped  bool    `json:"skipped,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	Duration float64 `json:"duration"`
+}
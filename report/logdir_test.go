@@ -0,0 +1,65 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-exec/runner"
+	"github.com/franela/goblin"
+)
+
+func TestLogDir(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "drone-exec")
+	defer os.RemoveAll(dir)
+
+	g := goblin.Goblin(t)
+	g.Describe("Step log directory", func() {
+
+		step := &runner.Step{
+			Node:  &parser.DockerNode{NodeType: parser.NodeCache, Image: "plugins/drone-cache:latest"},
+			Index: 1,
+		}
+
+		g.It("Should name the log by section, index and name", func() {
+			g.Assert(LogName(step)).Equal("cache-01-plugins_drone-cache_latest.log")
+			named := &runner.Step{Node: &parser.DockerNode{NodeType: parser.NodeDeploy, Name: "staging", Image: "plugins/drone-heroku"}}
+			g.Assert(LogName(named)).Equal("deploy-00-staging.log")
+		})
+
+		g.It("Should append to a step log opened twice", func() {
+			logs, err := NewLogDir(dir)
+			g.Assert(err == nil).IsTrue()
+
+			w, _ := logs.Open(step)
+			w.Write([]byte("restore\n"))
+			w.Close()
+			w, _ = logs.Open(step)
+			w.Write([]byte("rebuild\n"))
+			w.Close()
+
+			out, _ := ioutil.ReadFile(filepath.Join(dir, LogName(step)))
+			g.Assert(string(out)).Equal("restore\nrebuild\n")
+		})
+
+		g.It("Should write the index file", func() {
+			logs, _ := NewLogDir(dir)
+			step.Logged = true
+			service := &runner.Step{Node: &parser.DockerNode{NodeType: parser.NodeCompose, Name: "redis", Image: "redis"}}
+			err := logs.WriteIndex([]*runner.Step{step, service})
+			g.Assert(err == nil).IsTrue()
+
+			var index []*indexEntry
+			out, _ := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+			json.Unmarshal(out, &index)
+			g.Assert(len(index)).Equal(2)
+			g.Assert(index[0].File).Equal(LogName(step))
+			g.Assert(index[0].Section).Equal("cache")
+			g.Assert(index[1].File).Equal("")
+		})
+	})
+}
@@ -2,8 +2,9 @@ package runner
 
 import (
 	"errors"
+	"time"
 
-	// log "github.com/Sirupsen/logrus"
+	log "github.com/Sirupsen/logrus"
 	"github.com/drone/drone-exec/docker"
 	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-exec/runner/script"
@@ -21,6 +22,7 @@ const DefaultCacher = "plugins/drone-cache"
 type Build struct {
 	tree  *parser.Tree
 	flags parser.NodeType
+	index map[parser.NodeType]int
 }
 
 func (b *Build) Run(state *State) error {
@@ -29,6 +31,7 @@ func (b *Build) Run(state *State) error {
 
 func (b *Build) RunNode(state *State, flags parser.NodeType) error {
 	b.flags = flags
+	b.index = map[parser.NodeType]int{}
 	return b.walk(b.tree.Root, state)
 }
 
@@ -44,8 +47,10 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 		}
 
 	case *parser.FilterNode:
-		if isMatch(node, state) {
+		if reason := mismatch(node, state); len(reason) == 0 {
 			b.walk(node.Node, state)
+		} else {
+			b.skip(node.Node, reason, state)
 		}
 
 	case *parser.DockerNode:
@@ -55,6 +60,8 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 		if len(node.Image) == 0 {
 			break
 		}
+		step := b.step(node, state)
+
 		// auth for accessing private docker registries
 		var auth *dockerclient.AuthConfig
 		// auth to nil if password or token not set
@@ -73,40 +80,68 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 			// by defaulting the build steps to run when not failure. This is
 			// required now that we support multi-build steps.
 			if state.Failed() {
+				step.Skipped = true
+				step.Reason = "previous step failed"
 				return
 			}
 
 			conf := toContainerConfig(node)
 			conf.Env = append(conf.Env, toEnv(state)...)
-			conf.WorkingDir = state.Workspace.Path
+			conf.Env = append(conf.Env, toStepEnv(step)...)
+			conf.WorkingDir = toWorkingDir(state, node)
 			if state.Repo.IsPrivate {
 				script.Encode(state.Workspace, conf, node)
 			} else {
 				script.Encode(nil, conf, node)
 			}
 
-			info, err := docker.Run(state.Client, conf, auth, node.Pull, state.Stdout, state.Stderr)
+			step.begin(state)
+			info, err := docker.Run(state.Client, conf, auth, node.Pull, step.stdout(state), step.stderr(state))
+			step.end()
 			if err != nil {
-				state.Exit(255)
+				log.Errorf("Error running %s. %s", step, err)
+				step.exit(state, 255)
 			} else if info.State.ExitCode != 0 {
-				state.Exit(info.State.ExitCode)
+				step.exit(state, info.State.ExitCode)
 			}
 
 		case parser.NodeCompose:
 			conf := toContainerConfig(node)
+			conf.Env = append(conf.Env, toStepEnv(step)...)
+			if len(node.WorkingDir) != 0 {
+				conf.WorkingDir = toWorkingDir(state, node)
+			}
+			step.Started = time.Now()
 			_, err := docker.Start(state.Client, conf, auth, node.Pull)
 			if err != nil {
-				state.Exit(255)
+				step.Finished = time.Now()
+				log.Errorf("Error starting %s. %s", step, err)
+				step.exit(state, 255)
+				break
+			}
+			err = waitHealthy(state, node, auth)
+			step.Finished = time.Now()
+			if err != nil {
+				log.Errorf("Error starting %s. %s", step, err)
+				step.exit(state, 1)
 			}
 
 		default:
+			node := maybeEscalate(state, node, auth)
 			conf := toContainerConfig(node)
+			conf.Env = append(conf.Env, toStepEnv(step)...)
 			conf.Cmd = toCommand(state, node)
-			info, err := docker.Run(state.Client, conf, auth, node.Pull, state.Stdout, state.Stderr)
+			if len(node.WorkingDir) != 0 {
+				conf.WorkingDir = toWorkingDir(state, node)
+			}
+			step.begin(state)
+			info, err := docker.Run(state.Client, conf, auth, node.Pull, step.stdout(state), step.stderr(state))
+			step.end()
 			if err != nil {
-				state.Exit(255)
+				log.Errorf("Error running %s. %s", step, err)
+				step.exit(state, 255)
 			} else if info.State.ExitCode != 0 {
-				state.Exit(info.State.ExitCode)
+				step.exit(state, info.State.ExitCode)
 			}
 		}
 	}
@@ -114,21 +149,66 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 	return nil
 }
 
+// step is a helper function that records the execution
+// of the Docker node in the build state.
+func (b *Build) step(node *parser.DockerNode, state *State) *Step {
+	step := &Step{Node: node, Index: b.index[node.NodeType], Pipeline: state.Pipeline}
+	b.index[node.NodeType]++
+	state.Steps = append(state.Steps, step)
+	return step
+}
+
+// skip is a helper function that records the Docker node
+// as skipped, if it would otherwise have been executed.
+func (b *Build) skip(node parser.Node, reason string, state *State) {
+	d, ok := node.(*parser.DockerNode)
+	if !ok || shouldSkip(b.flags, d.NodeType) || len(d.Image) == 0 {
+		return
+	}
+	step := b.step(d, state)
+	step.Skipped = true
+	step.Reason = reason
+}
+
 func expectMatch() {
 
 }
 
 func maybeResolveImage() {}
 
-func maybeEscalate(conf dockerclient.ContainerConfig, node *parser.DockerNode) {
-	if node.Image == "plugins/drone-docker" || node.Image == "plugins/drone-gcr" {
-		return
+// maybeEscalate is a helper function that escalates a publish
+// plugin if its image has the trusted label configured by the
+// escalation policy, and is from a trusted registry or digest.
+// The escalated copy of the node is returned, or the node if
+// it is not escalated.
+func maybeEscalate(state *State, node *parser.DockerNode, auth *dockerclient.AuthConfig) *parser.DockerNode {
+	policy := state.Escalate
+	if policy == nil || node.NodeType != parser.NodePublish || !policy.TrustLabel(node.Image) {
+		return node
+	}
+	info, err := state.Client.InspectImage(node.Image)
+	if err != nil {
+		// the image may not exist on the host machine
+		// until it is pulled.
+		if err := state.Client.PullImage(node.Image, auth); err != nil {
+			log.Errorf("Error pulling %s to check the trusted label. %s", node.Image, err)
+			return node
+		}
+		info, err = state.Client.InspectImage(node.Image)
 	}
-	conf.Volumes = nil
-	conf.HostConfig.NetworkMode = ""
-	conf.HostConfig.Privileged = true
-	conf.Entrypoint = []string{}
-	conf.Cmd = []string{}
+	if err != nil {
+		log.Errorf("Error inspecting %s to check the trusted label. %s", node.Image, err)
+		return node
+	}
+	if info.Config == nil {
+		return node
+	}
+	if ok, _ := parseBool(info.Config.Labels[policy.Label]); !ok {
+		return node
+	}
+	escalated := *node
+	policy.Apply(&escalated)
+	return &escalated
 }
 
 // shouldSkip is a helper function that returns true if
@@ -137,11 +217,3 @@ func maybeEscalate(conf dockerclient.ContainerConfig, node *parser.DockerNode) {
 func shouldSkip(flags parser.NodeType, nodeType parser.NodeType) bool {
 	return flags != 0 && flags&nodeType == 0
 }
-
-// shouldEscalate is a helper function that returns true
-// if the plugin should be escalated to start the container
-// in privileged mode.
-func shouldEscalate(node *parser.DockerNode) bool {
-	return node.Image == "plugins/drone-docker" ||
-		node.Image == "plugins/drone-gcr"
-}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/drone/drone-exec/docker"
+	"github.com/samalba/dockerclient"
+)
+
+// DiffImage is the image used to list the files changed
+// since the previous build.
+const DiffImage = "plugins/drone-git"
+
+var shaRegexp = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// Diff returns the files changed between the commit of the
+// previous build and the commit of the current build, using
+// git in the cloned workspace. A nil slice is returned if
+// there is no previous build to compare against.
+func Diff(s *State) ([]string, error) {
+	if s.BuildLast == nil || len(s.BuildLast.Commit) == 0 {
+		return nil, nil
+	}
+	last, commit := s.BuildLast.Commit, s.Build.Commit
+	if !shaRegexp.MatchString(last) || !shaRegexp.MatchString(commit) {
+		return nil, fmt.Errorf("invalid commit sha %s..%s", last, commit)
+	}
+
+	conf := &dockerclient.ContainerConfig{
+		Image:      DiffImage,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{fmt.Sprintf("git diff --name-only %s %s", last, commit)},
+		WorkingDir: s.Workspace.Path,
+		HostConfig: dockerclient.HostConfig{
+			MemorySwappiness: -1,
+		},
+	}
+	var stdout bytes.Buffer
+	info, err := docker.Run(s.Client, conf, nil, false, &stdout, s.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if info.State.ExitCode != 0 {
+		return nil, fmt.Errorf("git diff exited with code %d", info.State.ExitCode)
+	}
+	return parseDiff(stdout.String()), nil
+}
+
+// parseDiff is a helper function that parses the output of
+// the git diff --name-only command.
+func parseDiff(out string) []string {
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); len(line) != 0 {
+			files = append(files, line)
+		}
+	}
+	return files
+}
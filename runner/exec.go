@@ -4,6 +4,7 @@ import (
 	"io"
 	"sync"
 
+	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-plugin-go/plugin"
 	"github.com/samalba/dockerclient"
 )
@@ -24,6 +25,31 @@ type State struct {
 	Client dockerclient.Client
 
 	Stdout, Stderr io.Writer
+
+	// Escalate defines the plugins granted elevated
+	// privileges based on a trusted image label.
+	Escalate *parser.EscalatePolicy
+
+	// Logger, when set, receives a copy of the output
+	// of each step.
+	Logger Logger
+
+	// Steps records each step executed, or skipped,
+	// in order of execution.
+	Steps []*Step
+
+	// Changes lists the files changed by the build, used
+	// to evaluate path conditions. Path conditions always
+	// match if the changed files are unknown.
+	Changes []string
+
+	// Deploy is the target environment of a deployment,
+	// used to evaluate environment conditions.
+	Deploy string
+
+	// Pipeline is the name of the pipeline executed, if
+	// the Yaml declares named pipelines.
+	Pipeline string
 }
 
 // Exit writes the exit code. A non-zero value
@@ -53,3 +79,8 @@ func (s *State) ExitCode() int {
 func (s *State) Failed() bool {
 	return s.ExitCode() != 0
 }
+
+// Logger opens a writer for the output of a single step.
+type Logger interface {
+	Open(*Step) (io.WriteCloser, error)
+}
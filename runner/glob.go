@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether the file name matches the glob
+// pattern. The pattern syntax is that of path.Match, where
+// a ** path segment additionally matches zero or more path
+// segments, for example web/**/*.js matches web/app.js and
+// web/src/app.js.
+func matchGlob(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	name = strings.TrimPrefix(name, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			// collapse consecutive ** segments to avoid
+			// needless backtracking.
+			for len(pattern) != 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
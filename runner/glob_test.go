@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestGlob(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Glob patterns", func() {
+
+		g.It("Should match path segments", func() {
+			g.Assert(matchGlob("web/*.js", "web/app.js")).IsTrue()
+			g.Assert(matchGlob("web/*.js", "web/src/app.js")).IsFalse()
+			g.Assert(matchGlob("README.?d", "README.md")).IsTrue()
+		})
+
+		g.It("Should match any number of segments with **", func() {
+			g.Assert(matchGlob("web/**", "web/src/app.js")).IsTrue()
+			g.Assert(matchGlob("web/**/*.js", "web/app.js")).IsTrue()
+			g.Assert(matchGlob("web/**/*.js", "web/src/lib/app.js")).IsTrue()
+			g.Assert(matchGlob("**/*.go", "main.go")).IsTrue()
+			g.Assert(matchGlob("**/**/vendor/**", "a/b/vendor/c/d.go")).IsTrue()
+			g.Assert(matchGlob("web/**/*.js", "api/app.js")).IsFalse()
+			g.Assert(matchGlob("web/**/*.js", "web/src/app.css")).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/drone/drone-exec/docker"
+	"github.com/drone/drone-exec/parser"
+	"github.com/samalba/dockerclient"
+)
+
+// Default health check options, matching Docker.
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+var errHealthTimeout = errors.New("health check timed out")
+
+// waitHealthy is a helper function that runs the health
+// check of the compose service until it succeeds, or the
+// retries are exhausted. The check runs in a container
+// created from the service image, sharing its network.
+func waitHealthy(state *State, node *parser.DockerNode, auth *dockerclient.AuthConfig) error {
+	check := node.Healthcheck
+	if check == nil {
+		return nil
+	}
+	cmd := healthCommand(check.Test.Slice())
+	if len(cmd) == 0 {
+		return nil
+	}
+	interval := parseDuration(check.Interval, DefaultHealthInterval)
+	timeout := parseDuration(check.Timeout, DefaultHealthTimeout)
+	retries := check.Retries
+	if retries <= 0 {
+		retries = DefaultHealthRetries
+	}
+
+	var err error
+	for i := 0; i < retries; i++ {
+		if i != 0 {
+			time.Sleep(interval)
+		}
+		conf := &dockerclient.ContainerConfig{
+			Image:      node.Image,
+			Env:        node.Environment,
+			Entrypoint: cmd[:1],
+			Cmd:        cmd[1:],
+			HostConfig: dockerclient.HostConfig{
+				MemorySwappiness: -1,
+			},
+		}
+		if err = runHealthcheck(state.Client, conf, auth, timeout); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("unhealthy after %d attempts. %s", retries, err)
+}
+
+// runHealthcheck is a helper function that runs the health
+// check command once, failing if it exceeds the timeout. The
+// container is always removed, which also ends the wait for
+// a health check that timed out.
+func runHealthcheck(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, timeout time.Duration) error {
+	info, err := docker.Start(client, conf, auth, false)
+	if info != nil {
+		defer func() {
+			client.KillContainer(info.Id, "9")
+			client.RemoveContainer(info.Id, true, true)
+		}()
+	}
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- waitHealthcheck(client, info.Id)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(timeout):
+		return errHealthTimeout
+	}
+}
+
+// waitHealthcheck is a helper function that waits for the
+// health check container to exit, by streaming its logs,
+// and returns an error if the exit code is not zero.
+func waitHealthcheck(client dockerclient.Client, id string) error {
+	rc, err := client.ContainerLogs(id, &dockerclient.LogOptions{Follow: true, Stdout: true, Stderr: true})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	io.Copy(ioutil.Discard, rc)
+
+	info, err := client.InspectContainer(id)
+	if err != nil {
+		return err
+	}
+	if info.State.ExitCode != 0 {
+		return fmt.Errorf("exit code %d", info.State.ExitCode)
+	}
+	return nil
+}
+
+// healthCommand is a helper function that converts the test
+// of a health check, in docker-compose format, to a command.
+// A string is executed using the shell. A nil command is
+// returned if the health check is disabled.
+func healthCommand(test []string) []string {
+	if len(test) == 0 {
+		return nil
+	}
+	switch test[0] {
+	case "NONE":
+		return nil
+	case "CMD":
+		return test[1:]
+	case "CMD-SHELL":
+		test = test[1:]
+	}
+	if len(test) != 1 {
+		return test
+	}
+	return []string{"/bin/sh", "-c", test[0]}
+}
+
+// parseDuration is a helper function that parses the
+// duration, or returns the default if empty or invalid.
+func parseDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
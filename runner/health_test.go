@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestHealthcheck(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Healthcheck", func() {
+
+		g.It("Should convert the test to a command", func() {
+			g.Assert(healthCommand([]string{"CMD", "redis-cli", "ping"})).Equal([]string{"redis-cli", "ping"})
+			g.Assert(healthCommand([]string{"CMD-SHELL", "pg_isready -U test"})).Equal([]string{"/bin/sh", "-c", "pg_isready -U test"})
+			g.Assert(healthCommand([]string{"curl -f localhost"})).Equal([]string{"/bin/sh", "-c", "curl -f localhost"})
+		})
+
+		g.It("Should disable the health check", func() {
+			g.Assert(healthCommand(nil) == nil).IsTrue()
+			g.Assert(healthCommand([]string{"NONE"}) == nil).IsTrue()
+		})
+
+		g.It("Should parse durations with a default", func() {
+			g.Assert(parseDuration("2s", time.Minute)).Equal(2 * time.Second)
+			g.Assert(parseDuration("", time.Minute)).Equal(time.Minute)
+			g.Assert(parseDuration("soon", time.Minute)).Equal(time.Minute)
+		})
+	})
+}
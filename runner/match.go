@@ -3,15 +3,26 @@ package runner
 import (
 	"fmt"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-exec/parser/expr"
 	"github.com/drone/drone-plugin-go/plugin"
 )
 
 // isMatch is a helper function that returns true if
 // all criteria is matched.
-func isMatch(node *parser.FilterNode, s *State) (match bool) {
+func isMatch(node *parser.FilterNode, s *State) bool {
+	return len(mismatch(node, s)) == 0
+}
+
+// mismatch is a helper function that returns the first
+// criteria not matched, formatted as it would appear in
+// the when section of the Yaml. An empty string is returned
+// if all criteria is matched.
+func mismatch(node *parser.FilterNode, s *State) string {
 
 	var last string
 	if s.BuildLast != nil {
@@ -20,25 +31,54 @@ func isMatch(node *parser.FilterNode, s *State) (match bool) {
 
 	switch {
 	case !matchBranch(node.Branch, s.Build.Branch):
-		return false
+		return fmt.Sprintf("branch: %s", strings.Join(node.Branch, ", "))
 	case !matchMatrix(node.Matrix, s.Job.Environment):
-		return false
+		return fmt.Sprintf("matrix: %s", formatMatrix(node.Matrix))
 	case !matchRepo(node.Repo, s.Repo.FullName):
-		return false
+		return fmt.Sprintf("repo: %s", node.Repo)
 	case !matchEvent(node.Event, s.Build.Event):
-		return false
+		return fmt.Sprintf("event: %s", strings.Join(node.Event, ", "))
+	case !matchExpr(node.Expr, s):
+		return fmt.Sprintf("expr: %s", node.Expr)
+	case !matchPaths(node.PathsInclude, node.PathsExclude, s.Changes):
+		return fmt.Sprintf("paths: %s", formatPaths(node.PathsInclude, node.PathsExclude))
+	case !matchTag(node.Tag, s.Build.Ref):
+		return fmt.Sprintf("tag: %s", strings.Join(node.Tag, ", "))
+	case !matchPatterns(node.Environment, s.Deploy):
+		return fmt.Sprintf("environment: %s", strings.Join(node.Environment, ", "))
 	}
 
 	switch {
 	case matchSuccess(node.Success, s.Job.Status):
-		return true
+		return ""
 	case matchFailure(node.Failure, s.Job.Status):
-		return true
+		return ""
 	case matchChange(node.Change, s.Job.Status, last):
-		return true
+		return ""
 	}
 
-	return false
+	var status []string
+	if len(node.Success) != 0 {
+		status = append(status, "success: "+node.Success)
+	}
+	if len(node.Failure) != 0 {
+		status = append(status, "failure: "+node.Failure)
+	}
+	if len(node.Change) != 0 {
+		status = append(status, "change: "+node.Change)
+	}
+	return strings.Join(status, ", ")
+}
+
+// formatMatrix is a helper function that formats the
+// matrix criteria in a consistent order.
+func formatMatrix(matrix map[string]string) string {
+	var parts []string
+	for k, v := range matrix {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
 }
 
 // matchBranch is a helper function that returns true
@@ -105,6 +145,145 @@ func matchMatrix(want, got map[string]string) bool {
 	return true
 }
 
+// matchExpr is a helper function that returns false if
+// the expression evaluates to false. Invalid expressions
+// are rejected by the parser, and never match.
+func matchExpr(src string, s *State) bool {
+	if len(src) == 0 {
+		return true
+	}
+	e, err := expr.Parse(src)
+	if err != nil {
+		return false
+	}
+	return e.Eval(exprVars(s))
+}
+
+// exprVars is a helper function that returns the build,
+// repo, job and matrix data available to expressions.
+func exprVars(s *State) map[string]string {
+	branch := strings.TrimPrefix(s.Build.Branch, "refs/heads/")
+	vars := map[string]string{
+		"repo":         s.Repo.FullName,
+		"branch":       branch,
+		"event":        s.Build.Event,
+		"commit":       s.Build.Commit,
+		"ref":          s.Build.Ref,
+		"status":       s.Job.Status,
+		"repo.name":    s.Repo.FullName,
+		"repo.private": strconv.FormatBool(s.Repo.IsPrivate),
+		"repo.trusted": strconv.FormatBool(s.Repo.IsTrusted),
+		"build.number": strconv.Itoa(s.Build.Number),
+		"build.event":  s.Build.Event,
+		"build.branch": branch,
+		"build.commit": s.Build.Commit,
+		"build.ref":    s.Build.Ref,
+		"build.status": s.Build.Status,
+		"job.number":   strconv.Itoa(s.Job.Number),
+		"job.status":   s.Job.Status,
+		"environment":  s.Deploy,
+	}
+	if strings.HasPrefix(s.Build.Ref, "refs/tags/") {
+		vars["tag"] = strings.TrimPrefix(s.Build.Ref, "refs/tags/")
+	}
+	if s.BuildLast != nil {
+		vars["build.previous_status"] = s.BuildLast.Status
+	}
+	for k, v := range s.Job.Environment {
+		vars["matrix."+k] = v
+	}
+	return vars
+}
+
+// matchPaths is a helper function that returns false if
+// none of the changed files match an include pattern without
+// matching an exclude pattern. It returns true if the changed
+// files are unknown.
+func matchPaths(include, exclude, changes []string) bool {
+	if len(include) == 0 && len(exclude) == 0 {
+		return true
+	}
+	if len(changes) == 0 {
+		return true
+	}
+	for _, file := range changes {
+		if (len(include) == 0 || matchAny(include, file)) && !matchAny(exclude, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTag is a helper function that returns false if
+// the step is limited to tags not matched by the ref of
+// the current build.
+func matchTag(want []string, ref string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(ref, "refs/tags/") {
+		return false
+	}
+	return matchPatterns(want, strings.TrimPrefix(ref, "refs/tags/"))
+}
+
+// matchPatterns is a helper function that returns true if
+// the value matches at least one of the patterns, if any,
+// and none of the patterns prefixed with !. For example
+// v* and !v*-rc* match v1.0 but not v1.0-rc1.
+func matchPatterns(patterns []string, got string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	var include, exclude []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			exclude = append(exclude, pattern[1:])
+		} else {
+			include = append(include, pattern)
+		}
+	}
+	if len(got) == 0 {
+		return false
+	}
+	for _, pattern := range exclude {
+		if match, _ := path.Match(pattern, got); match {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if match, _ := path.Match(pattern, got); match {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPaths is a helper function that formats the path
+// criteria.
+func formatPaths(include, exclude []string) string {
+	var parts []string
+	if len(include) != 0 {
+		parts = append(parts, "include "+strings.Join(include, ", "))
+	}
+	if len(exclude) != 0 {
+		parts = append(parts, "exclude "+strings.Join(exclude, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
 func matchSuccess(toggle, status string) bool {
 	ok, err := parseBool(toggle)
 	if err != nil {
@@ -3,6 +3,8 @@ package runner
 import (
 	"testing"
 
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-plugin-go/plugin"
 	"github.com/franela/goblin"
 )
 
@@ -64,6 +66,72 @@ func TestParse(t *testing.T) {
 		g.It("Should match an event", func() {
 			g.Assert(matchBranch([]string{"deployment"}, "deployment")).Equal(true)
 		})
+
+		g.It("Should describe the unmatched condition", func() {
+			s := &State{
+				Repo:  &plugin.Repo{FullName: "octocat/hello-world"},
+				Build: &plugin.Build{Branch: "develop", Event: "push"},
+				Job:   &plugin.Job{Status: "running"},
+			}
+			g.Assert(mismatch(&parser.FilterNode{}, s)).Equal("")
+			g.Assert(mismatch(&parser.FilterNode{Branch: []string{"master", "release/*"}}, s)).Equal("branch: master, release/*")
+			g.Assert(mismatch(&parser.FilterNode{Event: []string{"tag"}}, s)).Equal("event: tag")
+			g.Assert(mismatch(&parser.FilterNode{Success: "false", Failure: "true", Change: "false"}, s)).Equal("success: false, failure: true, change: false")
+		})
+
+		g.It("Should match changed paths", func() {
+			changes := []string{"api/main.go", "docs/index.md"}
+			g.Assert(matchPaths(nil, nil, changes)).IsTrue()
+			g.Assert(matchPaths([]string{"api/**"}, nil, changes)).IsTrue()
+			g.Assert(matchPaths([]string{"web/**"}, nil, changes)).IsFalse()
+			g.Assert(matchPaths(nil, []string{"**/*.md"}, changes)).IsTrue()
+			g.Assert(matchPaths(nil, []string{"**/*.md", "api/**"}, changes)).IsFalse()
+			g.Assert(matchPaths([]string{"web/**"}, nil, nil)).IsTrue()
+		})
+
+		g.It("Should describe the unmatched paths", func() {
+			s := &State{
+				Repo:    &plugin.Repo{},
+				Build:   &plugin.Build{},
+				Job:     &plugin.Job{},
+				Changes: []string{"api/main.go"},
+			}
+			node := &parser.FilterNode{PathsInclude: []string{"web/**"}, PathsExclude: []string{"**/*.md"}}
+			g.Assert(mismatch(node, s)).Equal("paths: include web/**; exclude **/*.md")
+		})
+
+		g.It("Should parse the changed files", func() {
+			g.Assert(parseDiff("api/main.go\nweb/app.js\n\n")).Equal([]string{"api/main.go", "web/app.js"})
+		})
+
+		g.It("Should match a tag", func() {
+			want := []string{"v*", "!v*-rc*"}
+			g.Assert(matchTag(nil, "refs/heads/master")).IsTrue()
+			g.Assert(matchTag(want, "refs/tags/v1.0")).IsTrue()
+			g.Assert(matchTag(want, "refs/tags/v1.0-rc1")).IsFalse()
+			g.Assert(matchTag(want, "refs/tags/1.0")).IsFalse()
+			g.Assert(matchTag(want, "refs/heads/v1.0")).IsFalse()
+		})
+
+		g.It("Should match a deployment environment", func() {
+			g.Assert(matchPatterns(nil, "")).IsTrue()
+			g.Assert(matchPatterns([]string{"production"}, "production")).IsTrue()
+			g.Assert(matchPatterns([]string{"production"}, "staging")).IsFalse()
+			g.Assert(matchPatterns([]string{"!production"}, "staging")).IsTrue()
+			g.Assert(matchPatterns([]string{"production"}, "")).IsFalse()
+		})
+
+		g.It("Should match an expression", func() {
+			s := &State{
+				Repo:  &plugin.Repo{FullName: "octocat/hello-world"},
+				Build: &plugin.Build{Branch: "refs/heads/main", Event: "push"},
+				Job:   &plugin.Job{Status: "running", Environment: map[string]string{"GO": "1.6"}},
+			}
+			g.Assert(matchExpr(`branch == "main" && event != "pull_request"`, s)).IsTrue()
+			g.Assert(matchExpr(`branch == "dev" || matrix.GO == "1.6"`, s)).IsTrue()
+			g.Assert(matchExpr(`repo != "octocat/hello-world"`, s)).IsFalse()
+			g.Assert(mismatch(&parser.FilterNode{Expr: `event == "tag"`}, s)).Equal(`expr: event == "tag"`)
+		})
 	})
 
 }
@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/drone/drone-exec/parser"
+)
+
+// TailLines is the number of trailing output lines
+// retained for each executed step.
+const TailLines = 20
+
+// Step represents the outcome of a single Docker node
+// that was executed, or skipped, as part of the build.
+type Step struct {
+	Node     *parser.DockerNode
+	Index    int    // position of the step within its section
+	Pipeline string // name of the pipeline, if any
+
+	Skipped  bool   // step was not executed
+	Reason   string // condition that excluded the step
+	ExitCode int
+
+	Started  time.Time
+	Finished time.Time
+	Logged   bool // step log was opened
+
+	output tail
+	logw   io.WriteCloser
+}
+
+// Section returns the name of the Yaml section in which
+// the step is declared.
+func (s *Step) Section() string {
+	return parser.Section(s.Node.NodeType)
+}
+
+// Name returns the display name of the step, which is
+// the key of the step in the Yaml, or the image of steps
+// that are not named, such as the clone step.
+func (s *Step) Name() string {
+	if len(s.Node.Name) != 0 {
+		return s.Node.Name
+	}
+	return s.Node.Image
+}
+
+// String returns a description of the step, including
+// its position in the Yaml, for use in messages.
+func (s *Step) String() string {
+	desc := fmt.Sprintf("%s step %s", s.Section(), s.Name())
+	if s.Node.Pos.IsValid() {
+		desc += " at " + s.Node.Pos.String()
+	}
+	return desc
+}
+
+// Duration returns the time spent executing the step.
+func (s *Step) Duration() time.Duration {
+	if s.Started.IsZero() || s.Finished.IsZero() {
+		return 0
+	}
+	return s.Finished.Sub(s.Started)
+}
+
+// Output returns the trailing lines of the step output.
+func (s *Step) Output() string {
+	return s.output.String()
+}
+
+// exit records the step exit code and writes the exit
+// code to the build state.
+func (s *Step) exit(state *State, code int) {
+	s.ExitCode = code
+	state.Exit(code)
+}
+
+// begin records the start of the step and, if the build
+// state has a Logger, opens the step log, starting with a
+// header naming the step.
+func (s *Step) begin(state *State) {
+	s.Started = time.Now()
+	log.Debugf("Running %s", s)
+	if state.Logger == nil {
+		return
+	}
+	w, err := state.Logger.Open(s)
+	if err != nil {
+		log.Errorf("Error opening log for %s. %s\n", s, err)
+		return
+	}
+	s.logw = &logWriter{step: s, w: w}
+	s.Logged = true
+	fmt.Fprintf(s.logw, "[%s] %s (%s)\n", s.Section(), s.Name(), s.Node.Image)
+}
+
+// end records the completion of the step and closes the
+// step log, if open.
+func (s *Step) end() {
+	s.Finished = time.Now()
+	if s.logw != nil {
+		s.logw.Close()
+		s.logw = nil
+	}
+}
+
+// stdout returns the writer used to capture the standard
+// output of the step.
+func (s *Step) stdout(state *State) io.Writer {
+	return s.writer(state.Stdout)
+}
+
+// stderr returns the writer used to capture the standard
+// error of the step.
+func (s *Step) stderr(state *State) io.Writer {
+	return s.writer(state.Stderr)
+}
+
+func (s *Step) writer(w io.Writer) io.Writer {
+	if s.logw != nil {
+		return io.MultiWriter(w, &s.output, s.logw)
+	}
+	return io.MultiWriter(w, &s.output)
+}
+
+// logWriter is an io.WriteCloser that writes to the step
+// log. The first write error, such as a full disk, is logged
+// and further writes are dropped, so that the output of the
+// step is still captured by the other writers.
+type logWriter struct {
+	step *Step
+	w    io.WriteCloser
+	err  error
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return len(p), nil
+	}
+	if _, err := l.w.Write(p); err != nil {
+		log.Errorf("Error writing log for %s. %s", l.step, err)
+		l.err = err
+	}
+	return len(p), nil
+}
+
+func (l *logWriter) Close() error {
+	return l.w.Close()
+}
+
+// tail is an io.Writer that retains only the last
+// TailLines lines written to it.
+type tail struct {
+	lines []string
+	buf   bytes.Buffer
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	for {
+		line, err := t.buf.ReadString('\n')
+		if err != nil {
+			// put back the incomplete line until
+			// the remainder is written.
+			t.buf.WriteString(line)
+			break
+		}
+		t.lines = append(t.lines, strings.TrimSuffix(line, "\n"))
+		if len(t.lines) > TailLines {
+			t.lines = t.lines[1:]
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	lines := t.lines
+	if t.buf.Len() != 0 {
+		lines = append(lines, t.buf.String())
+		if len(lines) > TailLines {
+			lines = lines[1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/drone/drone-exec/parser"
+	"github.com/franela/goblin"
+)
+
+func TestStep(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Step output", func() {
+
+		g.It("Should keep writing when the step log fails", func() {
+			var out bytes.Buffer
+			step := &Step{Node: &parser.DockerNode{Image: "golang"}}
+			step.logw = &logWriter{step: step, w: &failWriter{}}
+
+			w := step.writer(&out)
+			_, err := w.Write([]byte("go test\n"))
+			g.Assert(err == nil).IsTrue()
+			_, err = w.Write([]byte("ok\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out.String()).Equal("go test\nok\n")
+			g.Assert(step.Output()).Equal("go test\nok")
+			g.Assert(step.logw.(*logWriter).w.(*failWriter).writes).Equal(1)
+		})
+
+		g.It("Should record whether the step log was opened", func() {
+			step := &Step{Node: &parser.DockerNode{Image: "golang"}}
+			step.begin(&State{})
+			step.end()
+			g.Assert(step.Logged).IsFalse()
+
+			step.begin(&State{Logger: logger{}})
+			step.end()
+			g.Assert(step.Logged).IsTrue()
+		})
+	})
+}
+
+// failWriter is an io.WriteCloser that fails every write.
+type failWriter struct {
+	writes int
+}
+
+func (f *failWriter) Write(p []byte) (int, error) {
+	f.writes++
+	return 0, errors.New("no space left on device")
+}
+
+func (f *failWriter) Close() error { return nil }
+
+// logger is a Logger that opens a failWriter for each step.
+type logger struct{}
+
+func (logger) Open(*Step) (io.WriteCloser, error) { return &failWriter{}, nil }
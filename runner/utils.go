@@ -3,6 +3,7 @@ package runner
 import (
 	"encoding/json"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 
@@ -24,6 +25,8 @@ func toContainerConfig(n *parser.DockerNode) *dockerclient.ContainerConfig {
 		Env:        n.Environment,
 		Cmd:        n.Command,
 		Entrypoint: n.Entrypoint,
+		User:       n.User,
+		Hostname:   n.Hostname,
 		HostConfig: dockerclient.HostConfig{
 			Privileged:       n.Privileged,
 			NetworkMode:      n.Net,
@@ -31,10 +34,41 @@ func toContainerConfig(n *parser.DockerNode) *dockerclient.ContainerConfig {
 		},
 	}
 
+	if len(n.DNS) > 0 {
+		config.HostConfig.Dns = n.DNS
+	}
+
+	if len(n.DNSSearch) > 0 {
+		config.HostConfig.DnsSearch = n.DNSSearch
+	}
+
+	if len(n.CapDrop) > 0 {
+		config.HostConfig.CapDrop = n.CapDrop
+	}
+
+	for _, mount := range n.Tmpfs {
+		if config.HostConfig.Tmpfs == nil {
+			config.HostConfig.Tmpfs = map[string]string{}
+		}
+		parts := strings.SplitN(mount, ":", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		config.HostConfig.Tmpfs[parts[0]] = parts[1]
+	}
+
 	if len(n.ExtraHosts) > 0 {
 		config.HostConfig.ExtraHosts = n.ExtraHosts
 	}
 
+	if len(n.CapAdd) > 0 {
+		config.HostConfig.CapAdd = n.CapAdd
+	}
+
+	for _, device := range n.Devices {
+		config.HostConfig.Devices = append(config.HostConfig.Devices, toDevice(device))
+	}
+
 	if len(config.Entrypoint) == 0 {
 		config.Entrypoint = nil
 	}
@@ -52,6 +86,33 @@ func toContainerConfig(n *parser.DockerNode) *dockerclient.ContainerConfig {
 	return config
 }
 
+// helper function that returns the working directory of
+// the step. Relative paths are resolved in the workspace.
+func toWorkingDir(s *State, n *parser.DockerNode) string {
+	if path.IsAbs(n.WorkingDir) {
+		return n.WorkingDir
+	}
+	return path.Join(s.Workspace.Path, n.WorkingDir)
+}
+
+// helper function that converts a device string in the
+// host[:container[:permissions]] format to a device mapping.
+func toDevice(device string) dockerclient.DeviceMapping {
+	parts := strings.SplitN(device, ":", 3)
+	mapping := dockerclient.DeviceMapping{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+	if len(parts) > 1 {
+		mapping.PathInContainer = parts[1]
+	}
+	if len(parts) > 2 {
+		mapping.CgroupPermissions = parts[2]
+	}
+	return mapping
+}
+
 // helper function to inject drone-specific environment
 // variables into the container.
 func toEnv(s *State) []string {
@@ -98,13 +159,27 @@ func toEnv(s *State) []string {
 
 	if s.Build.Event == plugin.EventTag {
 		tag := strings.TrimPrefix(s.Build.Ref, "refs/tags/")
-		envs = append(envs, fmt.Sprintf("CI_TAG=%d", tag))
+		envs = append(envs, fmt.Sprintf("CI_TAG=%s", tag))
 		envs = append(envs, fmt.Sprintf("DRONE_TAG=%s", tag))
 	}
 
+	// environment variables specific to the deployment
+	if len(s.Deploy) != 0 {
+		envs = append(envs, fmt.Sprintf("DRONE_DEPLOY_TO=%s", s.Deploy))
+	}
+
 	return envs
 }
 
+// helper function to inject the name of the step into
+// the container.
+func toStepEnv(s *Step) []string {
+	return []string{
+		fmt.Sprintf("DRONE_STEP_NAME=%s", s.Name()),
+		fmt.Sprintf("CI_STEP_NAME=%s", s.Name()),
+	}
+}
+
 // helper function to encode the build step to
 // a json string. Primarily used for plugins, which
 // expect a json encoded string in stdin or arg[1].
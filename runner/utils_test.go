@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/franela/goblin"
+)
+
+func TestContainerConfig(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Container config", func() {
+
+		g.It("Should pass the container options", func() {
+			n := &parser.DockerNode{
+				Image:     "golang",
+				User:      "nobody",
+				Hostname:  "builder",
+				DNS:       []string{"8.8.8.8"},
+				DNSSearch: []string{"example.com"},
+				Tmpfs:     []string{"/run", "/tmp:size=64m"},
+				CapAdd:    []string{"NET_ADMIN"},
+				CapDrop:   []string{"MKNOD"},
+				Devices:   []string{"/dev/fuse"},
+			}
+			conf := toContainerConfig(n)
+			g.Assert(conf.User).Equal("nobody")
+			g.Assert(conf.Hostname).Equal("builder")
+			g.Assert(conf.HostConfig.Dns).Equal([]string{"8.8.8.8"})
+			g.Assert(conf.HostConfig.DnsSearch).Equal([]string{"example.com"})
+			g.Assert(conf.HostConfig.Tmpfs).Equal(map[string]string{"/run": "", "/tmp": "size=64m"})
+			g.Assert(conf.HostConfig.CapAdd).Equal([]string{"NET_ADMIN"})
+			g.Assert(conf.HostConfig.CapDrop).Equal([]string{"MKNOD"})
+			g.Assert(conf.HostConfig.Devices[0].PathInContainer).Equal("/dev/fuse")
+		})
+
+		g.It("Should resolve the working directory in the workspace", func() {
+			s := &State{Workspace: &plugin.Workspace{Path: "/drone/src/github.com/octocat/hello-world"}}
+			g.Assert(toWorkingDir(s, &parser.DockerNode{})).Equal("/drone/src/github.com/octocat/hello-world")
+			g.Assert(toWorkingDir(s, &parser.DockerNode{WorkingDir: "web"})).Equal("/drone/src/github.com/octocat/hello-world/web")
+			g.Assert(toWorkingDir(s, &parser.DockerNode{WorkingDir: "/go"})).Equal("/go")
+		})
+
+		g.It("Should pass the tag name", func() {
+			s := &State{
+				Repo:      &plugin.Repo{},
+				Build:     &plugin.Build{Event: plugin.EventTag, Ref: "refs/tags/v1.0.0"},
+				Job:       &plugin.Job{},
+				System:    &plugin.System{},
+				Workspace: &plugin.Workspace{},
+			}
+			envs := toEnv(s)
+			g.Assert(contains(envs, "CI_TAG=v1.0.0")).IsTrue()
+			g.Assert(contains(envs, "DRONE_TAG=v1.0.0")).IsTrue()
+		})
+
+		g.It("Should pass the step name", func() {
+			step := &Step{Node: &parser.DockerNode{Name: "test", Image: "golang"}}
+			g.Assert(toStepEnv(step)).Equal([]string{"DRONE_STEP_NAME=test", "CI_STEP_NAME=test"})
+			step = &Step{Node: &parser.DockerNode{Image: "plugins/drone-git"}}
+			g.Assert(toStepEnv(step)[0]).Equal("DRONE_STEP_NAME=plugins/drone-git")
+		})
+	})
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package yaml
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Healthcheck is a typed representation of the health check
+// of a compose service. The service is not considered started
+// until the test command succeeds.
+type Healthcheck struct {
+	Test     Stringorslice
+	Interval string
+	Timeout  string
+	Retries  int
+}
+
+// composeKeys defines the keys of a docker-compose service
+// that are imported. Other keys are rejected, since they
+// would silently behave differently in the build.
+var composeKeys = []string{
+	"image",
+	"environment",
+	"env_file",
+	"command",
+	"entrypoint",
+	"extra_hosts",
+	"healthcheck",
+}
+
+// composeErrors defines the messages reported for common
+// unsupported keys of a docker-compose service.
+var composeErrors = map[string]string{
+	"build":      "build is not supported, services must specify an image",
+	"ports":      "ports are not supported, services are reachable on localhost",
+	"expose":     "expose is not supported, services are reachable on localhost",
+	"links":      "links are not supported, services are reachable on localhost",
+	"depends_on": "depends_on is not supported, services are started in order",
+	"volumes":    "volumes are not supported, services share the build workspace",
+	"networks":   "networks are not supported, services share the build network",
+}
+
+// ParseCompose parses a docker-compose file and returns its
+// services, in order. Both the version 1 format and the
+// versioned format with a services section are supported.
+func ParseCompose(in []byte) ([]Container, error) {
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+	services := doc
+	if _, ok := lookup(doc, "version"); ok {
+		v, _ := lookup(doc, "services")
+		services = mapping(v)
+	}
+
+	var ctrs []Container
+	err := unmarshalYaml(services, func(name string, val []byte) error {
+		service := yaml.MapSlice{}
+		if err := yaml.Unmarshal(val, &service); err != nil {
+			return fmt.Errorf("service %s must be a mapping", name)
+		}
+		for _, item := range service {
+			key := fmt.Sprint(item.Key)
+			if contains(composeKeys, key) {
+				continue
+			}
+			if msg, ok := composeErrors[key]; ok {
+				return fmt.Errorf("service %s: %s", name, msg)
+			}
+			return fmt.Errorf("service %s: unsupported key %q", name, key)
+		}
+		ctr := Container{}
+		if err := yaml.Unmarshal(val, &ctr); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if len(ctr.Image) == 0 {
+			return fmt.Errorf("service %s: image is required", name)
+		}
+		ctr.Name = name
+		ctrs = append(ctrs, ctr)
+		return nil
+	})
+	return ctrs, err
+}
+
+// File returns the path of the docker-compose file from
+// which services are imported, if any.
+func (s *Containerslice) File() string {
+	return s.file
+}
+
+// Import imports the services of the docker-compose file.
+// Imported services are started first, unless replaced by a
+// service with the same name in the Yaml.
+func (s *Containerslice) Import(in []byte) error {
+	ctrs, err := ParseCompose(in)
+	if err != nil {
+		return fmt.Errorf("compose file %s: %s", s.file, err)
+	}
+	var parts []Service
+	for _, ctr := range ctrs {
+		service := Service{Container: ctr}
+		for _, override := range s.parts {
+			if override.Name == ctr.Name {
+				service = override
+				break
+			}
+		}
+		parts = append(parts, service)
+	}
+	for _, ctr := range s.parts {
+		if !containsName(ctrs, ctr.Name) {
+			parts = append(parts, ctr)
+		}
+	}
+	s.parts = parts
+	return nil
+}
+
+func containsName(ctrs []Container, name string) bool {
+	for _, ctr := range ctrs {
+		if ctr.Name == name {
+			return true
+		}
+	}
+	return false
+}
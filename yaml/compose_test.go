@@ -0,0 +1,103 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestCompose(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Compose", func() {
+
+		g.It("Should parse services in order", func() {
+			ctrs, err := ParseCompose([]byte(sampleCompose))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(ctrs)).Equal(2)
+			g.Assert(ctrs[0].Name).Equal("postgres")
+			g.Assert(ctrs[0].Image).Equal("postgres:9.5")
+			g.Assert(ctrs[0].Environment.Slice()).Equal([]string{"POSTGRES_USER=test"})
+			g.Assert(ctrs[0].Healthcheck.Test.Slice()).Equal([]string{"CMD-SHELL", "pg_isready"})
+			g.Assert(ctrs[0].Healthcheck.Interval).Equal("2s")
+			g.Assert(ctrs[0].Healthcheck.Retries).Equal(10)
+			g.Assert(ctrs[1].Name).Equal("redis")
+			g.Assert(ctrs[1].Command.Slice()).Equal([]string{"redis-server", "--appendonly", "yes"})
+			g.Assert(ctrs[1].ExtraHosts).Equal([]string{"cache:127.0.0.1"})
+		})
+
+		g.It("Should parse services without a version", func() {
+			ctrs, err := ParseCompose([]byte("redis:\n  image: redis\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(ctrs)).Equal(1)
+			g.Assert(ctrs[0].Image).Equal("redis")
+		})
+
+		g.It("Should reject unsupported keys", func() {
+			_, err := ParseCompose([]byte("version: '2'\nservices:\n  web:\n    build: .\n"))
+			g.Assert(err.Error()).Equal("service web: build is not supported, services must specify an image")
+			_, err = ParseCompose([]byte("web:\n  image: nginx\n  ports: [ '80:80' ]\n"))
+			g.Assert(err.Error()).Equal("service web: ports are not supported, services are reachable on localhost")
+			_, err = ParseCompose([]byte("web:\n  image: nginx\n  restart: always\n"))
+			g.Assert(err.Error()).Equal(`service web: unsupported key "restart"`)
+		})
+
+		g.It("Should require an image", func() {
+			_, err := ParseCompose([]byte("web:\n  command: nginx\n"))
+			g.Assert(err.Error()).Equal("service web: image is required")
+		})
+
+		g.It("Should import the compose file", func() {
+			conf, err := ParseString("compose:\n  file: docker-compose.ci.yml\n  redis:\n    image: redis:3\n  mysql:\n    image: mysql\n")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Compose.File()).Equal("docker-compose.ci.yml")
+			g.Assert(len(conf.Compose.Slice())).Equal(2)
+			g.Assert(conf.Compose.Slice()[0].Pos.Line).Equal(3)
+
+			err = conf.Compose.Import([]byte(sampleCompose))
+			g.Assert(err == nil).IsTrue()
+			ctrs := conf.Compose.Slice()
+			g.Assert(len(ctrs)).Equal(3)
+			g.Assert(ctrs[0].Name).Equal("postgres")
+			g.Assert(ctrs[1].Name).Equal("redis")
+			g.Assert(ctrs[1].Image).Equal("redis:3")
+			g.Assert(ctrs[2].Name).Equal("mysql")
+		})
+
+		g.It("Should keep the when section of replaced services", func() {
+			conf, err := ParseString("compose:\n  file: docker-compose.ci.yml\n  redis:\n    image: redis:3\n    when: { branch: master }\n")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Compose.Slice()[0].Filter.Pos.Line).Equal(5)
+
+			err = conf.Compose.Import([]byte(sampleCompose))
+			g.Assert(err == nil).IsTrue()
+			ctrs := conf.Compose.Slice()
+			g.Assert(ctrs[0].Filter.Branch.Slice()).Equal([]string(nil))
+			g.Assert(ctrs[1].Filter.Branch.Slice()).Equal([]string{"master"})
+		})
+
+		g.It("Should report the compose file in errors", func() {
+			conf, err := ParseString("compose:\n  file: docker-compose.ci.yml\n")
+			g.Assert(err == nil).IsTrue()
+			err = conf.Compose.Import([]byte("web:\n  build: .\n"))
+			g.Assert(err.Error()).Equal("compose file docker-compose.ci.yml: service web: build is not supported, services must specify an image")
+		})
+	})
+}
+
+var sampleCompose = `
+version: '2'
+services:
+  postgres:
+    image: postgres:9.5
+    environment:
+      POSTGRES_USER: test
+    healthcheck:
+      test: [ CMD-SHELL, pg_isready ]
+      interval: 2s
+      retries: 10
+  redis:
+    image: redis
+    command: redis-server --appendonly yes
+    extra_hosts: [ "cache:127.0.0.1" ]
+`
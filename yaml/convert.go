@@ -0,0 +1,127 @@
+package yaml
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Convert converts a Yaml configuration file in the version 1
+// format to the version 2 format. Steps are written in the
+// order their sections are executed, each with a unique name.
+// Templates are expanded, and comments are not preserved.
+func Convert(in []byte) ([]byte, error) {
+	pipelines, err := ParsePipelines(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(pipelines) == 1 && len(pipelines[0].Name) == 0 {
+		conf, err := pipelines[0].Parse()
+		if err != nil {
+			return nil, err
+		}
+		out, err := convert(conf)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(out)
+	}
+
+	// the version is written once, and is shared by each
+	// of the named pipelines.
+	var named yaml.MapSlice
+	for _, pipeline := range pipelines {
+		conf, err := pipeline.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %s", pipeline.Name, err)
+		}
+		out, err := convert(conf)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %s", pipeline.Name, err)
+		}
+		out.Version = 0
+		named = append(named, yaml.MapItem{Key: pipeline.Name, Value: out})
+	}
+	return yaml.Marshal(yaml.MapSlice{
+		{Key: "version", Value: Version2},
+		{Key: "pipelines", Value: named},
+	})
+}
+
+// convert is a helper function that converts the version 1
+// configuration to the version 2 configuration.
+func convert(c *Config) (*Config, error) {
+	if c.Version >= Version2 {
+		return nil, fmt.Errorf("already version %d", c.Version)
+	}
+	if len(c.Compose.file) != 0 {
+		return nil, fmt.Errorf("compose file %s cannot be converted, declare its services as service steps", c.Compose.file)
+	}
+	out := &Config{
+		Version:     Version2,
+		Debug:       c.Debug,
+		Environment: c.Environment,
+		Defaults:    c.Defaults,
+	}
+	names := map[string]bool{}
+	add := func(typ, name string, ctr Container) *Step {
+		step := Step{Container: ctr, Type: typ}
+		step.Name = uniqueName(names, name)
+		step.Pos, step.Keys = Position{}, nil
+		out.Pipeline.parts = append(out.Pipeline.parts, step)
+		return &out.Pipeline.parts[len(out.Pipeline.parts)-1]
+	}
+	plugin := func(typ, name string, p Plugin) {
+		step := add(typ, name, p.Container)
+		step.Settings = p.Vargs
+		step.Filter = p.Filter
+	}
+
+	// the cache section configures the native cache if
+	// paths are listed, which is not a step.
+	if _, ok := c.Cache.Vargs["paths"]; ok {
+		out.Cache = c.Cache
+	} else if len(c.Cache.marshal()) != 0 {
+		plugin(StepCache, "cache", c.Cache)
+	}
+	if len(c.Clone.marshal()) != 0 {
+		plugin(StepClone, "clone", c.Clone)
+	}
+	for _, ctr := range c.Compose.parts {
+		step := add(StepService, ctr.Name, ctr.Container)
+		step.Filter = ctr.Filter
+	}
+	for _, b := range c.Build.parts {
+		name := b.Name
+		if len(name) == 0 {
+			name = "build"
+		}
+		step := add(StepBuild, name, b.Container)
+		step.Commands = b.Commands
+		step.Filter = b.Filter
+	}
+	for _, section := range []struct {
+		typ     string
+		plugins Pluginslice
+	}{
+		{StepPublish, c.Publish},
+		{StepDeploy, c.Deploy},
+		{StepNotify, c.Notify},
+	} {
+		for _, p := range section.plugins.parts {
+			plugin(section.typ, stepName(&p.Container), p)
+		}
+	}
+	return out, nil
+}
+
+// uniqueName is a helper function that returns the name,
+// suffixed with a number if the name is already used.
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	names[unique] = true
+	return unique
+}
@@ -0,0 +1,103 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestConvert(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Convert", func() {
+
+		g.It("Should convert sections to named steps", func() {
+			out, err := Convert([]byte(sampleConvert))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(sampleConverted)
+
+			conf, err := Parse(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(conf.Pipeline.Slice())).Equal(6)
+		})
+
+		g.It("Should convert named pipelines", func() {
+			out, err := Convert([]byte("pipelines:\n  docs:\n    build: { image: node, commands: [ npm test ] }\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal("version: 2\npipelines:\n  docs:\n    pipeline:\n    - name: build\n      type: build\n      image: node\n      commands:\n      - npm test\n")
+		})
+
+		g.It("Should not convert version 2", func() {
+			_, err := Convert([]byte(sampleVersion2))
+			g.Assert(err.Error()).Equal("already version 2")
+		})
+
+		g.It("Should not convert compose files", func() {
+			_, err := Convert([]byte("compose:\n  file: docker-compose.yml\n"))
+			g.Assert(err.Error()).Equal("compose file docker-compose.yml cannot be converted, declare its services as service steps")
+		})
+	})
+}
+
+var sampleConvert = `
+debug: true
+clone:
+  path: github.com/octocat/hello-world
+compose:
+  redis:
+    image: redis:3
+build:
+  build:
+    image: golang
+    commands: [ go build ]
+  test:
+    image: golang
+    commands: [ go test ]
+    when:
+      branch: master
+publish:
+  docker:
+    repo: octocat/hello-world
+    when: { event: push }
+notify:
+  slack:
+    channel: dev
+`
+
+var sampleConverted = `version: 2
+debug: true
+pipeline:
+- name: clone
+  type: clone
+  settings:
+    path: github.com/octocat/hello-world
+- name: redis
+  type: service
+  image: redis:3
+- name: build
+  type: build
+  image: golang
+  commands:
+  - go build
+- name: test
+  type: build
+  image: golang
+  commands:
+  - go test
+  when:
+    branch:
+    - master
+- name: docker
+  type: publish
+  image: docker
+  settings:
+    repo: octocat/hello-world
+  when:
+    event:
+    - push
+- name: slack
+  type: notify
+  image: slack
+  settings:
+    channel: dev
+`
@@ -0,0 +1,204 @@
+// Package dotenv parses environment files in the dotenv
+// format.
+//
+// Each line declares a variable in the KEY=VALUE format,
+// optionally prefixed with export. Blank lines and lines
+// starting with # are ignored. Values may be quoted:
+//
+//	PLAIN=value # comment
+//	SINGLE='literal $value'
+//	DOUBLE="line one\nline two"
+//
+// Single quoted values are literal. Double quoted values
+// may span multiple lines, and support the \n, \r, \t, \"
+// and \\ escape sequences. Unquoted values are trimmed, and
+// end at a # preceded by whitespace.
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse parses the environment file and returns the
+// variables in the KEY=VALUE format, in order.
+func Parse(in []byte) ([]string, error) {
+	p := parser{src: strings.Replace(string(in), "\r\n", "\n", -1), line: 1}
+	var env []string
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return env, nil
+		}
+		key, val, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, key+"="+val)
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips whitespace, blank lines and comments.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine skips to the end of the line.
+func (p *parser) skipLine() {
+	for !p.eof() && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// variable parses a variable declaration.
+func (p *parser) variable() (key, val string, err error) {
+	key = p.word()
+	if key == "export" && !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.skipSpace()
+		key = p.word()
+	}
+	if len(key) == 0 {
+		return "", "", p.errorf("invalid variable name")
+	}
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != '=' {
+		return "", "", p.errorf("expected = after %s", key)
+	}
+	p.pos++
+	p.skipSpace()
+
+	if !p.eof() {
+		switch p.src[p.pos] {
+		case '\'':
+			val, err = p.single()
+		case '"':
+			val, err = p.double()
+		default:
+			val = p.unquoted()
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// only a comment may follow the value.
+	p.skipSpace()
+	if !p.eof() && p.src[p.pos] != '\n' && p.src[p.pos] != '#' {
+		return "", "", p.errorf("unexpected characters after the value of %s", key)
+	}
+	p.skipLine()
+	return key, val, nil
+}
+
+// word parses a variable name.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() && isNameChar(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// single parses a literal single quoted value.
+func (p *parser) single() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end == -1 || p.src[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated single quoted value")
+	}
+	val := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return val, nil
+}
+
+// double parses a double quoted value, which may span
+// multiple lines and contain escape sequences.
+func (p *parser) double() (string, error) {
+	line := p.line
+	p.pos++
+	var buf []byte
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return string(buf), nil
+		case '\n':
+			p.line++
+		case '\\':
+			if p.eof() {
+				break
+			}
+			switch e := p.src[p.pos]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case '"', '\\':
+				c = e
+			default:
+				buf = append(buf, c)
+				continue
+			}
+			p.pos++
+		}
+		buf = append(buf, c)
+	}
+	return "", fmt.Errorf("line %d: unterminated double quoted value", line)
+}
+
+// unquoted parses an unquoted value, ending at a comment.
+func (p *parser) unquoted() string {
+	start := p.pos
+	for !p.eof() && p.src[p.pos] != '\n' {
+		if p.src[p.pos] == '#' && (p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			break
+		}
+		p.pos++
+	}
+	return strings.TrimSpace(p.src[start:p.pos])
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c == '.', c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
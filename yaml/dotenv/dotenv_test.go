@@ -0,0 +1,57 @@
+package dotenv
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestParse(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Parse dotenv", func() {
+
+		g.It("Should parse variables in order", func() {
+			env, err := Parse([]byte(sampleEnv))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(env).Equal([]string{
+				"PLAIN=value",
+				"SPACED=hello world",
+				"EXPORTED=1",
+				"EMPTY=",
+				"SINGLE=literal $value \\n # not a comment",
+				"DOUBLE=line one\nline two \"quoted\"",
+				"MULTI=first\nsecond",
+				"URL=http://example.com/#anchor",
+				"dotted.name=ok",
+			})
+		})
+
+		g.It("Should report errors with the line", func() {
+			_, err := Parse([]byte("FOO=bar\nBAR\n"))
+			g.Assert(err.Error()).Equal("line 2: expected = after BAR")
+			_, err = Parse([]byte("1FOO=bar"))
+			g.Assert(err.Error()).Equal("line 1: invalid variable name")
+			_, err = Parse([]byte("FOO='bar"))
+			g.Assert(err.Error()).Equal("line 1: unterminated single quoted value")
+			_, err = Parse([]byte("\nFOO=\"bar\n"))
+			g.Assert(err.Error()).Equal("line 2: unterminated double quoted value")
+			_, err = Parse([]byte("FOO=\"bar\" baz"))
+			g.Assert(err.Error()).Equal("line 1: unexpected characters after the value of FOO")
+		})
+	})
+}
+
+var sampleEnv = `
+# database settings
+PLAIN=value
+SPACED = hello world   # trailing comment
+export EXPORTED=1
+EMPTY=
+SINGLE='literal $value \n # not a comment'
+DOUBLE="line one\nline two \"quoted\""
+MULTI="first
+second"
+URL=http://example.com/#anchor
+dotted.name=ok
+`
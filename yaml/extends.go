@@ -0,0 +1,259 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// namedSections defines the sections holding a mapping of
+// named steps.
+var namedSections = []string{"compose", "publish", "deploy", "notify"}
+
+// expand is a helper function that resolves the extends key
+// of each step in the Yaml configuration file. A step extends
+// a step definition declared in the templates section, or in
+// a top-level x- key, which is deep merged with the step.
+func expand(in []byte) ([]byte, error) {
+	if !bytes.Contains(in, []byte("extends")) {
+		return in, nil
+	}
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+
+	e := &expander{templates: map[string]yaml.MapSlice{}}
+	for _, item := range doc {
+		key := fmt.Sprint(item.Key)
+		switch {
+		case key == "templates":
+			for _, tmpl := range mapping(item.Value) {
+				e.templates[fmt.Sprint(tmpl.Key)] = mapping(tmpl.Value)
+			}
+		case strings.HasPrefix(key, "x-"):
+			if m := mapping(item.Value); m != nil {
+				e.templates[key] = m
+			}
+		}
+	}
+
+	for i, item := range doc {
+		key := fmt.Sprint(item.Key)
+		if key == "pipeline" {
+			if err := e.list(item.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		section := mapping(item.Value)
+		if section == nil {
+			continue
+		}
+		var err error
+		switch {
+		case key == "clone" || key == "cache":
+			doc[i].Value, err = e.step(key, section)
+		case key == "build" && isStep(section):
+			doc[i].Value, err = e.step(key, section)
+		case key == "build" || contains(namedSections, key):
+			doc[i].Value, err = e.steps(key, section)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return yaml.Marshal(doc)
+}
+
+type expander struct {
+	templates map[string]yaml.MapSlice
+}
+
+// steps resolves the extends key of each named step.
+func (e *expander) steps(section string, steps yaml.MapSlice) (yaml.MapSlice, error) {
+	for i, item := range steps {
+		step := mapping(item.Value)
+		if step == nil {
+			continue
+		}
+		var err error
+		steps[i].Value, err = e.step(fmt.Sprintf("%s %v", section, item.Key), step)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// list resolves the extends key of each step in the
+// pipeline section of the version 2 Yaml.
+func (e *expander) list(v interface{}) error {
+	steps, _ := v.([]interface{})
+	for i, item := range steps {
+		step := mapping(item)
+		if step == nil {
+			continue
+		}
+		name, ok := lookup(step, "name")
+		if !ok {
+			name = i + 1
+		}
+		var err error
+		steps[i], err = e.step(fmt.Sprintf("step %v", name), step)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// step resolves the extends key of the step.
+func (e *expander) step(name string, step yaml.MapSlice) (yaml.MapSlice, error) {
+	step, err := e.resolve(step, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return step, nil
+}
+
+// resolve is a helper function that recursively merges the
+// step with the templates it extends. The chain of extended
+// templates is used to detect circular references.
+func (e *expander) resolve(step yaml.MapSlice, chain []string) (yaml.MapSlice, error) {
+	value, ok := lookup(step, "extends")
+	if !ok {
+		return step, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("extends must be a template name")
+	}
+	for _, prev := range chain {
+		if prev == name {
+			return nil, fmt.Errorf("circular extends %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+	base, ok := e.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("extends unknown template %q", name)
+	}
+	base, err := e.resolve(base, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var override yaml.MapSlice
+	for _, item := range step {
+		if fmt.Sprint(item.Key) != "extends" {
+			override = append(override, item)
+		}
+	}
+	merged := deepMerge(base, override)
+
+	// environment lists are merged by variable name, as
+	// environment mappings are merged by deepMerge.
+	a, _ := lookup(base, "environment")
+	b, _ := lookup(override, "environment")
+	if env := mergeEnvironment(a, b); env != nil {
+		for i, item := range merged {
+			if fmt.Sprint(item.Key) == "environment" {
+				merged[i].Value = env
+			}
+		}
+	}
+	return merged, nil
+}
+
+// mergeEnvironment is a helper function that merges two
+// environment lists by variable name. Variables of the
+// override replace variables of the base in place, and new
+// variables are appended. It returns nil unless both are
+// lists.
+func mergeEnvironment(base, override interface{}) []interface{} {
+	a, ok := base.([]interface{})
+	if !ok {
+		return nil
+	}
+	b, ok := override.([]interface{})
+	if !ok {
+		return nil
+	}
+	name := func(v interface{}) string {
+		return strings.SplitN(fmt.Sprint(v), "=", 2)[0]
+	}
+	merged := append([]interface{}{}, a...)
+	for _, v := range b {
+		found := false
+		for i, prev := range merged {
+			if name(prev) == name(v) {
+				merged[i], found = v, true
+			}
+		}
+		if !found {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// deepMerge is a helper function that merges the override
+// into a copy of the base. Nested mappings are merged, while
+// other values are replaced.
+func deepMerge(base, override yaml.MapSlice) yaml.MapSlice {
+	merged := append(yaml.MapSlice{}, base...)
+	for _, item := range override {
+		found := false
+		for i, prev := range merged {
+			if fmt.Sprint(prev.Key) != fmt.Sprint(item.Key) {
+				continue
+			}
+			a, b := mapping(prev.Value), mapping(item.Value)
+			if a != nil && b != nil {
+				merged[i].Value = deepMerge(a, b)
+			} else {
+				merged[i].Value = item.Value
+			}
+			found = true
+			break
+		}
+		if !found {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// isStep is a helper function that returns true if the
+// build section is a single build step, as opposed to a
+// mapping of named build steps.
+func isStep(section yaml.MapSlice) bool {
+	_, image := lookup(section, "image")
+	_, extends := lookup(section, "extends")
+	return image || extends
+}
+
+func lookup(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func mapping(v interface{}) yaml.MapSlice {
+	m, _ := v.(yaml.MapSlice)
+	return m
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
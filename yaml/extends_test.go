@@ -0,0 +1,101 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestExtends(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Extends", func() {
+
+		g.It("Should merge build steps with the template", func() {
+			conf, err := ParseString(sampleExtends)
+			g.Assert(err == nil).IsTrue()
+			builds := conf.Build.Slice()
+			g.Assert(len(builds)).Equal(2)
+			g.Assert(builds[0].Image).Equal("golang:1.6")
+			g.Assert(builds[0].Volumes).Equal([]string{"/tmp/go:/go"})
+			g.Assert(builds[0].Commands).Equal([]string{"go test"})
+			g.Assert(builds[1].Image).Equal("golang:1.5")
+			g.Assert(builds[1].Environment.Slice()).Equal([]string{"CGO_ENABLED=0"})
+		})
+
+		g.It("Should deep merge plugin arguments", func() {
+			conf, err := ParseString(sampleExtends)
+			g.Assert(err == nil).IsTrue()
+			deploy := conf.Deploy.Slice()[0]
+			g.Assert(deploy.Image).Equal("plugins/drone-ssh")
+			g.Assert(deploy.Vargs["host"]).Equal("example.com")
+			g.Assert(deploy.Vargs["when"] == nil).IsTrue()
+			g.Assert(deploy.Filter.Branch.Slice()).Equal([]string{"master"})
+			g.Assert(deploy.Filter.Event.Slice()).Equal([]string{"push"})
+		})
+
+		g.It("Should extend a single build step from an x- key", func() {
+			conf, err := ParseString("x-base: { image: golang }\nbuild: { extends: x-base, commands: [ go test ] }")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Slice()[0].Image).Equal("golang")
+			g.Assert(conf.Build.Slice()[0].Commands).Equal([]string{"go test"})
+		})
+
+		g.It("Should merge environment lists by variable name", func() {
+			conf, err := ParseString("x-go:\n  image: golang\n  environment: [ GOOS=linux, CGO_ENABLED=0 ]\nbuild:\n  extends: x-go\n  environment: [ CGO_ENABLED=1, GOARCH=arm ]\n")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Slice()[0].Environment.Slice()).Equal([]string{"GOOS=linux", "CGO_ENABLED=1", "GOARCH=arm"})
+		})
+
+		g.It("Should error on an unknown template", func() {
+			_, err := ParseString("build: { test: { extends: golang } }")
+			g.Assert(err.Error()).Equal(`build test: extends unknown template "golang"`)
+		})
+
+		g.It("Should error on a circular extends", func() {
+			_, err := ParseString(sampleCircular)
+			g.Assert(err.Error()).Equal("notify slack: circular extends a -> b -> a")
+		})
+	})
+}
+
+var sampleExtends = `
+templates:
+  go:
+    image: golang:1.6
+    volumes: [ /tmp/go:/go ]
+  go15:
+    extends: go
+    image: golang:1.5
+    environment:
+      CGO_ENABLED: 0
+  ssh:
+    image: plugins/drone-ssh
+    host: example.com
+    when:
+      branch: master
+      event: tag
+
+build:
+  test:
+    extends: go
+    commands: [ go test ]
+  legacy:
+    extends: go15
+    commands: [ go test ]
+
+deploy:
+  ssh:
+    extends: ssh
+    when:
+      event: push
+`
+
+var sampleCircular = `
+templates:
+  a: { extends: b }
+  b: { extends: a }
+notify:
+  slack:
+    extends: a
+`
@@ -0,0 +1,263 @@
+// Package format implements canonical formatting of the Yaml
+// configuration file. Comments are preserved.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/drone/drone-exec/yaml"
+	yamlv2 "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ErrChanged is returned if formatting would change the
+// meaning of the configuration, for example by moving an
+// alias before its anchor.
+var ErrChanged = errors.New("formatting changes the meaning of the Yaml")
+
+// configOrder defines the order of the top-level keys.
+// Keys prefixed with x- are written with the templates,
+// after the version, since they usually declare anchors.
+// Unknown keys are written last.
+var configOrder = []string{
+	"version", "templates", "debug", "environment", "defaults", "cache", "clone", "compose",
+	"build", "publish", "deploy", "notify", "pipeline", "pipelines",
+}
+
+// stepOrder defines the order of the keys of a step.
+// Plugin arguments are written after the known keys, in
+// their original order, followed by the when section.
+var stepOrder = []string{
+	"name", "type", "extends", "image", "pull", "privileged",
+	"environment", "env_file", "entrypoint", "command", "commands", "extra_hosts",
+	"volumes", "net", "working_dir", "user", "hostname", "dns",
+	"dns_search", "tmpfs", "cap_add", "cap_drop", "devices",
+	"proxy", "auth_config", "healthcheck", "settings",
+}
+
+// filterOrder defines the order of the keys of a when
+// section.
+var filterOrder = []string{
+	"repo", "branch", "event", "tag", "environment", "success",
+	"failure", "change", "matrix", "paths", "expr",
+}
+
+// stringOrSlice defines the keys of a when section that
+// accept a string or a list, and are written as a list.
+var stringOrSlice = []string{"branch", "event", "tag", "environment"}
+
+// Format formats the Yaml configuration file, normalizing
+// the indentation, the order of keys and the form of values
+// that accept a string or a list.
+func Format(in []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return in, nil
+	}
+	config(doc.Content[0])
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	out := buf.Bytes()
+
+	// the formatted configuration is parsed and compared to
+	// the original configuration to verify its meaning is
+	// unchanged.
+	ok, err := equal(in, out)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrChanged
+	}
+	return out, nil
+}
+
+func config(n *yamlv3.Node) {
+	if n.Kind != yamlv3.MappingNode {
+		return
+	}
+	sortKeys(n, configOrder, func(key string) int {
+		if strings.HasPrefix(key, "x-") {
+			return indexOf(configOrder, "templates")
+		}
+		return len(configOrder)
+	})
+	each(n, func(key string, val *yamlv3.Node) {
+		switch key {
+		case "clone", "cache":
+			step(val)
+		case "build":
+			if lookup(val, "image") != nil || lookup(val, "extends") != nil {
+				step(val)
+			} else {
+				each(val, func(_ string, val *yamlv3.Node) { step(val) })
+			}
+		case "templates", "compose", "publish", "deploy", "notify":
+			each(val, func(_ string, val *yamlv3.Node) { step(val) })
+		case "pipeline":
+			if val.Kind == yamlv3.SequenceNode {
+				for _, item := range val.Content {
+					step(item)
+				}
+			}
+		case "pipelines":
+			each(val, func(_ string, val *yamlv3.Node) { config(val) })
+		}
+	})
+}
+
+func step(n *yamlv3.Node) {
+	if n.Kind != yamlv3.MappingNode {
+		return
+	}
+	sortKeys(n, stepOrder, func(key string) int {
+		if key == "when" {
+			return len(stepOrder) + 1
+		}
+		return len(stepOrder)
+	})
+	if when := lookup(n, "when"); when != nil && when.Kind == yamlv3.MappingNode {
+		filter(when)
+	}
+}
+
+func filter(n *yamlv3.Node) {
+	sortKeys(n, filterOrder, nil)
+	each(n, func(key string, val *yamlv3.Node) {
+		switch {
+		case contains(stringOrSlice, key):
+			toSlice(val)
+		case key == "paths":
+			each(val, func(_ string, val *yamlv3.Node) { toSlice(val) })
+		}
+	})
+}
+
+// toSlice is a helper function that converts a scalar to
+// a single item list.
+func toSlice(n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode || n.Tag == "!!null" {
+		return
+	}
+	item := *n
+	item.HeadComment, item.LineComment, item.FootComment = "", "", ""
+	*n = yamlv3.Node{
+		Kind:        yamlv3.SequenceNode,
+		Tag:         "!!seq",
+		Style:       yamlv3.FlowStyle,
+		Content:     []*yamlv3.Node{&item},
+		HeadComment: n.HeadComment,
+		LineComment: n.LineComment,
+		FootComment: n.FootComment,
+	}
+}
+
+// sortKeys is a helper function that sorts the keys of the
+// mapping by their position in the order. The rank function
+// returns the position of keys not in the order, if not nil.
+// The sort is stable.
+func sortKeys(n *yamlv3.Node, order []string, rank func(string) int) {
+	type pair struct {
+		key, val *yamlv3.Node
+		rank     int
+	}
+	var pairs []pair
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		r := indexOf(order, key.Value)
+		switch {
+		case key.Value == "<<":
+			r = -2 // merge keys first
+		case r == -1 && rank != nil:
+			r = rank(key.Value)
+		case r == -1:
+			r = len(order)
+		}
+		pairs = append(pairs, pair{key, n.Content[i+1], r})
+	}
+	// insertion sort, since the mappings are small and the
+	// sort must be stable.
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && pairs[j].rank < pairs[j-1].rank; j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p.key, p.val)
+	}
+}
+
+func each(n *yamlv3.Node, fn func(key string, val *yamlv3.Node)) {
+	if n.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fn(n.Content[i].Value, n.Content[i+1])
+	}
+}
+
+func lookup(n *yamlv3.Node, name string) *yamlv3.Node {
+	var found *yamlv3.Node
+	each(n, func(key string, val *yamlv3.Node) {
+		if key == name {
+			found = val
+		}
+	})
+	return found
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func contains(list []string, s string) bool {
+	return indexOf(list, s) != -1
+}
+
+// equal is a helper function that returns true if both
+// configuration files, including any pipelines, parse to
+// the same configuration. An error is returned if the
+// first configuration file cannot be parsed.
+func equal(a, b []byte) (bool, error) {
+	pa, err := yaml.ParsePipelines(a)
+	if err != nil {
+		return false, err
+	}
+	pb, err := yaml.ParsePipelines(b)
+	if err != nil || len(pa) != len(pb) {
+		return false, nil
+	}
+	for i := range pa {
+		ca, err := pa[i].Parse()
+		if err != nil {
+			return false, err
+		}
+		cb, err := pb[i].Parse()
+		if err != nil || pa[i].Name != pb[i].Name {
+			return false, nil
+		}
+		oa, _ := yamlv2.Marshal(ca)
+		ob, _ := yamlv2.Marshal(cb)
+		if !bytes.Equal(oa, ob) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
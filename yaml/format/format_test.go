@@ -0,0 +1,112 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func Test_Format(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Format", func() {
+
+		g.It("Should order keys and keep comments", func() {
+			out, err := Format([]byte(sampleUnformatted))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(sampleFormatted)
+		})
+
+		g.It("Should be idempotent", func() {
+			out, err := Format([]byte(sampleFormatted))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(sampleFormatted)
+		})
+
+		g.It("Should format named pipelines", func() {
+			out, err := Format([]byte(samplePipelines))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(samplePipelinesFormatted)
+		})
+
+		g.It("Should reject malformed Yaml", func() {
+			_, err := Format([]byte("build: [\n"))
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should return parse errors", func() {
+			_, err := Format([]byte("build:\n  image: golang\n  pull: maybe\n"))
+			g.Assert(err == nil).IsFalse()
+			g.Assert(err == ErrChanged).IsFalse()
+		})
+
+		g.It("Should format environment mappings", func() {
+			in := "build:\n  image: golang\n  environment:\n    GOOS: linux\n    GOARCH: amd64\n    CGO_ENABLED: 0\n    GOPATH: /go\n    GO111MODULE: off\n"
+			for i := 0; i < 10; i++ {
+				out, err := Format([]byte(in))
+				g.Assert(err == nil).IsTrue()
+				g.Assert(string(out)).Equal(in)
+			}
+		})
+	})
+}
+
+var sampleUnformatted = `
+notify:
+    slack:
+        when: { branch: master }
+        channel: dev
+        image: plugins/slack
+# the build step
+build:
+    commands:
+        - go test   # run the tests
+    image: golang
+    when:
+        event: push
+        paths:
+            include: "*.go"
+clone:
+    path: github.com/octocat/hello-world
+`
+
+var sampleFormatted = `clone:
+  path: github.com/octocat/hello-world
+# the build step
+build:
+  image: golang
+  commands:
+    - go test # run the tests
+  when:
+    event: [push]
+    paths:
+      include: ["*.go"]
+notify:
+  slack:
+    image: plugins/slack
+    channel: dev
+    when: {branch: [master]}
+`
+
+var samplePipelines = `
+pipelines:
+  backend:
+    build:
+      commands: [ go test ]
+      image: golang
+  frontend:
+    build:
+      commands: [ npm test ]
+      image: node
+`
+
+var samplePipelinesFormatted = `pipelines:
+  backend:
+    build:
+      image: golang
+      commands: [go test]
+  frontend:
+    build:
+      image: node
+      commands: [npm test]
+`
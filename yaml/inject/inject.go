@@ -1,7 +1,8 @@
 package inject
 
 import (
-	"sort"
+	"fmt"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,29 +11,21 @@ import (
 // the resulting string.
 //
 // Parameters are represented in the string using $$ notation, similar
-// to how environment variables are defined in Makefiles.
+// to how environment variables are defined in Makefiles. Variables
+// that are not in the map are left unchanged, see Substitute.
 func Inject(raw string, params map[string]string) string {
 	if params == nil || len(params) == 0 {
 		return raw
 	}
-	keys := []string{}
-	for k := range params {
-		keys = append(keys, k)
-	}
-	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
-	injected := raw
-	for _, k := range keys {
-		v := params[k]
-
-		for _, substitute := range substitutors {
-			injected = substitute(injected, k, v)
-		}
-	}
+	injected, _ := Substitute(raw, params)
 	return injected
 }
 
 // InjectSafe attempts to safely inject parameters without leaking
-// parameters in the Build or Compose section of the yaml file.
+// parameters in the Build section of the yaml file, the build steps
+// of the pipeline section, the environment and defaults shared with
+// the build steps, the templates extended by build steps, or these
+// sections of named pipelines.
 //
 // The intended use case for this function are public pull requests.
 // We want to avoid a malicious pull request that allows someone
@@ -49,21 +42,77 @@ func InjectSafe(raw string, params map[string]string) (string, error) {
 	if err != nil {
 		return raw, err
 	}
-	after.Build = before.Build
+	preserve(after, before)
 	result, err := yaml.Marshal(after)
 	return string(result), err
 }
 
-// parse unmarshals the yaml file into an intermediate representation
-// that isolates the build section. This allows us to modify the rest
-// of the Yaml file while preserving the build section.
-func parse(raw string) (*config, error) {
-	conf := &config{}
+// parse unmarshals the yaml file into an ordered intermediate
+// representation. This allows us to modify the rest of the Yaml
+// file while preserving the build sections.
+func parse(raw string) (yaml.MapSlice, error) {
+	conf := yaml.MapSlice{}
 	err := yaml.Unmarshal([]byte(raw), &conf)
 	return conf, err
 }
 
-type config struct {
-	Build map[string]interface{} `yaml:"build"`
-	Vargs map[string]interface{} `yaml:"vargs,inline"`
+// preserve restores the build section, the build steps of the
+// pipeline section, the environment and defaults sections, and
+// the templates that build steps may extend, to the values
+// before injection. Named pipelines are preserved recursively.
+func preserve(after, before yaml.MapSlice) {
+	for i, item := range after {
+		prev, _ := lookup(before, item.Key)
+		key := fmt.Sprint(item.Key)
+		switch {
+		case key == "build" || key == "environment" || key == "defaults",
+			key == "templates" || strings.HasPrefix(key, "x-"):
+			after[i].Value = prev
+		case key == "pipeline":
+			after[i].Value = preserveSteps(item.Value, prev)
+		case key == "pipelines":
+			for _, p := range mapping(item.Value) {
+				prev, _ := lookup(mapping(prev), p.Key)
+				preserve(mapping(p.Value), mapping(prev))
+			}
+		}
+	}
+}
+
+// preserveSteps restores the build steps of the pipeline to
+// the values before injection. If the injection changed the
+// steps, the steps before injection are returned.
+func preserveSteps(after, before interface{}) interface{} {
+	a, _ := after.([]interface{})
+	b, _ := before.([]interface{})
+	if len(a) != len(b) {
+		return before
+	}
+	for i := range a {
+		if isBuild(a[i]) || isBuild(b[i]) {
+			a[i] = b[i]
+		}
+	}
+	return a
+}
+
+// isBuild returns true if the step is a build step, which is
+// the default type of step.
+func isBuild(step interface{}) bool {
+	typ, _ := lookup(mapping(step), "type")
+	return typ == nil || typ == "" || typ == "build"
+}
+
+func lookup(m yaml.MapSlice, key interface{}) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func mapping(v interface{}) yaml.MapSlice {
+	m, _ := v.(yaml.MapSlice)
+	return m
 }
@@ -3,6 +3,7 @@ package inject
 import (
 	"testing"
 
+	droneyaml "github.com/drone/drone-exec/yaml"
 	"github.com/franela/goblin"
 	"gopkg.in/yaml.v2"
 )
@@ -26,6 +27,12 @@ func Test_Inject(t *testing.T) {
 			g.Assert(s).Equal(Inject(s, m))
 		})
 
+		g.It("Should not replace vars in injected values", func() {
+			s := Inject("echo $$SECRET $$TOKEN", map[string]string{"SECRET": "x$$DRONE_BRANCH", "TOKEN": "a$$$$b"})
+			s = Inject(s, map[string]string{"DRONE_BRANCH": "master"})
+			g.Assert(Unescape(s)).Equal("echo x$$DRONE_BRANCH a$$$$b")
+		})
+
 		g.It("Should not replace vars in nil map", func() {
 			s := "echo $$FOO $BAR"
 			g.Assert(s).Equal(Inject(s, nil))
@@ -62,7 +69,8 @@ func Test_Inject(t *testing.T) {
 			g.Assert(err == nil).IsTrue()
 
 			after := struct {
-				Build struct {
+				Environment []string
+				Build       struct {
 					Image    string
 					Commands []string
 				}
@@ -90,6 +98,7 @@ func Test_Inject(t *testing.T) {
 			g.Assert(err == nil).IsTrue()
 			g.Assert(after.Build.Commands[0]).Equal("echo $$TOKEN")
 			g.Assert(after.Build.Commands[1]).Equal("echo $$SECRET")
+			g.Assert(after.Environment[0]).Equal("TOKEN=$$TOKEN")
 			g.Assert(after.Deploy.Heroku.Token).Equal("FOO")
 			g.Assert(after.Deploy.Heroku.Secret).Equal("BAR")
 			g.Assert(after.Publish.Amazon.Token).Equal("FOO")
@@ -97,10 +106,85 @@ func Test_Inject(t *testing.T) {
 			g.Assert(after.Notify.Slack.Token).Equal("FOO")
 			g.Assert(after.Notify.Slack.Secret).Equal("BAR")
 		})
+
+		g.It("Should not inject params into extended templates", func() {
+			m := map[string]string{"SECRET": "hunter2"}
+			s, err := InjectSafe("x-t: { commands: [ echo $$SECRET ] }\ntemplates: { t: { commands: [ echo $$SECRET ] } }\nbuild: { a: { extends: x-t, image: golang }, b: { extends: t, image: golang } }\n", m)
+			g.Assert(err == nil).IsTrue()
+
+			conf, err := droneyaml.ParseString(s)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Slice()[0].Commands).Equal([]string{"echo $$SECRET"})
+			g.Assert(conf.Build.Slice()[1].Commands).Equal([]string{"echo $$SECRET"})
+		})
+
+		g.It("Should safely inject params into named pipelines", func() {
+			m := map[string]string{"TOKEN": "FOO"}
+			s, err := InjectSafe("pipelines:\n  docs:\n    build: { image: node, commands: [ echo $$TOKEN ] }\n    deploy: { heroku: { token: $$TOKEN } }\n", m)
+			g.Assert(err == nil).IsTrue()
+
+			pipelines, err := droneyaml.ParsePipelinesString(s)
+			g.Assert(err == nil).IsTrue()
+			docs, err := pipelines[0].Parse()
+			g.Assert(err == nil).IsTrue()
+			g.Assert(docs.Build.Slice()[0].Commands).Equal([]string{"echo $$TOKEN"})
+			g.Assert(docs.Deploy.Slice()[0].Vargs["token"]).Equal("FOO")
+		})
+
+		g.It("Should safely inject params into pipelines", func() {
+			m := map[string]string{"TOKEN": "FOO"}
+			s, err := InjectSafe(beforePipelines, m)
+			g.Assert(err == nil).IsTrue()
+
+			after := struct {
+				Pipelines map[string]struct {
+					Build struct {
+						Commands []string
+					}
+					Pipeline []struct {
+						Name     string
+						Commands []string
+						Settings map[string]string
+					}
+				}
+			}{}
+			err = yaml.Unmarshal([]byte(s), &after)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(after.Pipelines["backend"].Build.Commands[0]).Equal("echo $$TOKEN")
+			steps := after.Pipelines["frontend"].Pipeline
+			g.Assert(steps[0].Commands[0]).Equal("echo $$TOKEN")
+			g.Assert(steps[1].Commands[0]).Equal("echo $$TOKEN")
+			g.Assert(steps[2].Settings["token"]).Equal("FOO")
+		})
 	})
 }
 
+var beforePipelines = `
+pipelines:
+  backend:
+    build:
+      image: golang
+      commands: [ echo $$TOKEN ]
+  frontend:
+    version: 2
+    pipeline:
+      - name: test
+        image: node
+        commands: [ echo $$TOKEN ]
+      - name: lint
+        type: build
+        image: node
+        commands: [ echo $$TOKEN ]
+      - name: heroku
+        type: deploy
+        image: heroku
+        settings:
+          token: $$TOKEN
+`
+
 var before = `
+environment:
+  - TOKEN=$$TOKEN
 build:
   image: foo
   commands:
@@ -1,8 +1,8 @@
 package inject
 
 import (
+	"bytes"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -10,177 +10,262 @@ import (
 // these are helper functions that bring bash-substitution
 // to the drone yaml file.
 // see http://tldp.org/LDP/abs/html/parameter-substitution.html
+//
+// The string is scanned once, left to right. Each expression
+// is resolved against the parameters and substituted values
+// are never scanned again. The supported expressions are:
+//
+//   $$NAME             the value
+//   "$$NAME"           the value, quoted and escaped using %q
+//   $${NAME}           the value
+//   $${NAME##prefix}   the value minus the trimmed prefix
+//   $${NAME%%suffix}   the value minus the trimmed suffix
+//   $${NAME=default}   the value, or the default when empty
+//   $${NAME/old/new}   the value with old replaced by new
+//   $${NAME:len}       the value up to the specified length
+//   $${NAME:pos:len}   the substring of the value
+//   $$$$               a literal $$, see Unescape
+//
+// Expressions of unknown parameters, or that cannot be
+// applied to the value, are left unchanged. Each $$ of a
+// substituted value is escaped as $$$$.
 
-type substituteFunc func(str, key, val string) string
-
-var substitutors = []substituteFunc{
-	substituteQ,
-	substitute,
-	substituteBracket,
-	substitutePrefix,
-	substituteSuffix,
-	substituteDefault,
-	substituteReplace,
-	substituteLeft,
-	substituteSubstr,
+// Substitute substitutes the parameters into the string
+// and returns the result, along with the names of the
+// variables that are not in the parameters, in order of
+// appearance. Escaped $$$$ are left unchanged, and $$ of the
+// substituted values are escaped, so that the string can be
+// substituted again with other parameters.
+func Substitute(raw string, params map[string]string) (string, []string) {
+	s := &scanner{params: params, seen: map[string]bool{}}
+	return s.expand(raw), s.unknown
 }
 
-// substitute is a helper function that substitutes
-// a simple parameter using $parameter notation.
-func substitute(str, key, val string) string {
-	key = fmt.Sprintf("$$%s", key)
-	return strings.Replace(str, key, val, -1)
+// Unknown returns the names of the variables in the string,
+// which are left after substituting every parameter.
+func Unknown(raw string) []string {
+	_, names := Substitute(raw, nil)
+	return names
 }
 
-// substituteQ is a helper function that substitutes
-// a simple parameter using "$parameter" notation with
-// the escaped value, using %q.
-func substituteQ(str, key, val string) string {
-	key = fmt.Sprintf(`"$$%s"`, key)
-	val = fmt.Sprintf("%q", val)
-	return strings.Replace(str, key, val, -1)
+// Unescape replaces each escaped $$$$ with a literal $$.
+// It should be applied once, after every parameter is
+// substituted.
+func Unescape(raw string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(raw); {
+		switch {
+		case strings.HasPrefix(raw[i:], "$$$$"):
+			buf.WriteString("$$")
+			i += 4
+		case strings.HasPrefix(raw[i:], "$$"):
+			buf.WriteString("$$")
+			i += 2
+		default:
+			buf.WriteByte(raw[i])
+			i++
+		}
+	}
+	return buf.String()
 }
 
-// substituteBracket is a helper function that substitutes
-// paramters using ${parameter} notation with the value.
-func substituteBracket(str, key, val string) string {
-	key = fmt.Sprintf("$${%s}", key)
-	return strings.Replace(str, key, val, -1)
+// scanner substitutes the expressions of a string.
+type scanner struct {
+	params  map[string]string
+	unknown []string
+	seen    map[string]bool
 }
 
-// substitutePrefix is a helper function that substitutes
-// paramters using ${parameter##prefix} notation with the
-// parameter value minus the trimmed prefix.
-func substitutePrefix(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s##(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
-	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
+func (s *scanner) expand(str string) string {
+	var buf bytes.Buffer
+	var quote bool // last byte written is a literal quote
+	for i := 0; i < len(str); {
+		if !strings.HasPrefix(str[i:], "$$") {
+			quote = str[i] == '"'
+			buf.WriteByte(str[i])
+			i++
 			continue
 		}
-		val_ := strings.TrimPrefix(val, match[1])
-		str = strings.Replace(str, match[0], val_, -1)
+		rest := str[i+2:]
+		switch {
+		case strings.HasPrefix(rest, "$$"):
+			buf.WriteString("$$$$")
+			i += 4
+
+		case strings.HasPrefix(rest, "{"):
+			end := closing(rest[1:])
+			if end < 0 {
+				buf.WriteString("$${")
+				i += 3
+				break
+			}
+			buf.WriteString(s.bracket(rest[1 : end+1]))
+			i += end + 4
+
+		default:
+			name := identifier(rest)
+			if len(name) == 0 {
+				buf.WriteString("$$")
+				i += 2
+				break
+			}
+			key, ok := s.prefix(name)
+			if !ok {
+				s.report(name)
+				buf.WriteString("$$" + name)
+				i += 2 + len(name)
+				break
+			}
+			val := s.params[key]
+			i += 2 + len(key)
+			if quote && i < len(str) && str[i] == '"' {
+				buf.Truncate(buf.Len() - 1)
+				val = fmt.Sprintf("%q", val)
+				i++
+			}
+			buf.WriteString(escape(val))
+		}
+		quote = false
 	}
-	return str
+	return buf.String()
 }
 
-// substituteSuffix is a helper function that substitutes
-// paramters using ${parameter%%suffix} notation with the
-// parameter value minus the trimmed suffix.
-func substituteSuffix(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s%%%%(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+// bracket substitutes the $${...} expression, where expr
+// is the expression between the brackets.
+func (s *scanner) bracket(expr string) string {
+	name := identifier(expr)
+	if len(name) == 0 {
+		return "$${" + s.expand(expr) + "}"
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
-			continue
-		}
-		val_ := strings.TrimSuffix(val, match[1])
-		str = strings.Replace(str, match[0], val_, -1)
+	op := expr[len(name):]
+	val, ok := s.params[name]
+	if !ok {
+		s.report(name)
+		return "$${" + name + s.expand(op) + "}"
 	}
-	return str
+	if out, ok := s.apply(val, op); ok {
+		return out
+	}
+	return "$${" + name + s.expand(op) + "}"
 }
 
-// substituteDefault is a helper function that substitutes
-// paramters using ${parameter=default} notation with the
-// parameter value. When empty the default value is used.
-func substituteDefault(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s=(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+// apply applies the operation of the $${...} expression
+// to the value, and returns the escaped result.
+func (s *scanner) apply(val, op string) (string, bool) {
+	if strings.HasPrefix(op, "=") && len(op) > 1 && len(val) == 0 {
+		// the default is already substituted and escaped.
+		return s.expand(op[1:]), true
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
-			continue
+	out, ok := applyOp(val, op)
+	return escape(out), ok
+}
+
+// applyOp applies the operation of the $${...} expression
+// to the value.
+func applyOp(val, op string) (string, bool) {
+	switch {
+	case len(op) == 0:
+		return val, true
+
+	case strings.HasPrefix(op, "##") && len(op) > 2:
+		return strings.TrimPrefix(val, op[2:]), true
+
+	case strings.HasPrefix(op, "%%") && len(op) > 2:
+		return strings.TrimSuffix(val, op[2:]), true
+
+	case strings.HasPrefix(op, "=") && len(op) > 1:
+		return val, true
+
+	case strings.HasPrefix(op, "/"):
+		i := strings.LastIndex(op, "/")
+		if i < 2 || i == len(op)-1 {
+			return "", false
 		}
-		if len(val) == 0 {
-			str = strings.Replace(str, match[0], match[1], -1)
-		} else {
-			str = strings.Replace(str, match[0], val, -1)
+		old, with := op[1:i], op[i+1:]
+		return strings.Replace(val, old, with, -1), true
+
+	case strings.HasPrefix(op, ":"):
+		parts := strings.Split(op[1:], ":")
+		switch len(parts) {
+		case 1:
+			index, err := strconv.Atoi(parts[0])
+			if err != nil || index < 0 || index > len(val)-1 {
+				return "", false
+			}
+			return val[:index], true
+		case 2:
+			pos, err := strconv.Atoi(parts[0])
+			if err != nil || pos < 0 {
+				return "", false
+			}
+			length, err := strconv.Atoi(parts[1])
+			if err != nil || length < 0 || pos+length > len(val)-1 {
+				return "", false
+			}
+			return val[pos : pos+length], true
 		}
 	}
-	return str
+	return "", false
 }
 
-// substituteReplace is a helper function that substitutes
-// paramters using ${parameter/old/new} notation with the
-// parameter value. A find and replace is performed before
-// injecting the strings, replacing the old pattern with the
-// new value.
-func substituteReplace(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s/(.+)/(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
-	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 3 {
-			continue
+// prefix returns the longest parameter name that prefixes
+// the identifier, such that $$COMMIT_SHORT is substituted
+// with both COMMIT and COMMIT_SHORT parameters.
+func (s *scanner) prefix(name string) (string, bool) {
+	for i := len(name); i > 0; i-- {
+		if _, ok := s.params[name[:i]]; ok {
+			return name[:i], true
 		}
-		with := strings.Replace(val, match[1], match[2], -1)
-		str = strings.Replace(str, match[0], with, -1)
 	}
-	return str
+	return "", false
 }
 
-// substituteLeft is a helper function that substitutes
-// paramters using ${parameter:pos} notation with the
-// parameter value, sliced up to the specified position.
-func substituteLeft(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s:([0-9]*)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+func (s *scanner) report(name string) {
+	if !s.seen[name] {
+		s.seen[name] = true
+		s.unknown = append(s.unknown, name)
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
-			continue
-		}
-		index, err := strconv.Atoi(match[1])
-		if err != nil {
-			continue // skip
-		}
-		if index > len(val)-1 {
-			continue // skip
-		}
+}
 
-		str = strings.Replace(str, match[0], val[:index], -1)
-	}
-	return str
+// escape escapes each $$ of the substituted value as $$$$,
+// so that it is not substituted again, see Unescape.
+func escape(val string) string {
+	return strings.Replace(val, "$$", "$$$$", -1)
 }
 
-// substituteLeft is a helper function that substitutes
-// paramters using ${parameter:pos:len} notation with the
-// parameter value as a substring, starting at the specified
-// position for the specified length.
-func substituteSubstr(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s:([0-9]*):([0-9]*)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
-	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 3 {
-			continue
-		}
-		pos, err := strconv.Atoi(match[1])
-		if err != nil {
-			continue // skip
+// closing returns the index of the bracket closing the
+// $${...} expression, skipping nested expressions, or -1
+// if the expression is not closed on the same line.
+func closing(str string) int {
+	var depth int
+	for i := 0; i < len(str); i++ {
+		switch {
+		case str[i] == '\n':
+			return -1
+		case strings.HasPrefix(str[i:], "$$$$"):
+			i += 3
+		case strings.HasPrefix(str[i:], "$${"):
+			depth++
+			i += 2
+		case str[i] == '}' && depth == 0:
+			return i
+		case str[i] == '}':
+			depth--
 		}
-		length, err := strconv.Atoi(match[2])
-		if err != nil {
-			continue // skip
-		}
-		if pos+length > len(val)-1 {
-			continue // skip
+	}
+	return -1
+}
+
+// identifier returns the leading letters, digits and
+// underscores of the string.
+func identifier(str string) string {
+	i := 0
+	for i < len(str) {
+		c := str[i]
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
 		}
-		str = strings.Replace(str, match[0], val[pos:pos+length], -1)
+		i++
 	}
-	return str
+	return str[:i]
 }
@@ -25,49 +25,94 @@ func Test_Substitution(t *testing.T) {
 		g.It("Should substitute quoted parameters", func() {
 			before := "echo $${GREETING} WORLD"
 			after := "echo HELLO WORLD"
-			g.Assert(substituteBracket(before, "GREETING", "HELLO")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "HELLO")).Equal(after)
 		})
 
 		g.It("Should substitute parameters and trim prefix", func() {
 			before := "echo $${GREETING##asdf} WORLD"
 			after := "echo HELLO WORLD"
-			g.Assert(substitutePrefix(before, "GREETING", "asdfHELLO")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "asdfHELLO")).Equal(after)
 		})
 
 		g.It("Should substitute parameters and trim suffix", func() {
 			before := "echo $${GREETING%%asdf} WORLD"
 			after := "echo HELLO WORLD"
-			g.Assert(substituteSuffix(before, "GREETING", "HELLOasdf")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "HELLOasdf")).Equal(after)
 		})
 
 		g.It("Should substitute parameters without using the default", func() {
 			before := "echo $${GREETING=HOLA} WORLD"
 			after := "echo HELLO WORLD"
-			g.Assert(substituteDefault(before, "GREETING", "HELLO")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "HELLO")).Equal(after)
 		})
 
 		g.It("Should substitute parameters using the a default", func() {
 			before := "echo $${GREETING=HOLA} WORLD"
 			after := "echo HOLA WORLD"
-			g.Assert(substituteDefault(before, "GREETING", "")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "")).Equal(after)
 		})
 
 		g.It("Should substitute parameters with replacement", func() {
 			before := "echo $${GREETING/HE/A} MONDE"
 			after := "echo ALLO MONDE"
-			g.Assert(substituteReplace(before, "GREETING", "HELLO")).Equal(after)
+			g.Assert(substitute(before, "GREETING", "HELLO")).Equal(after)
 		})
 
 		g.It("Should substitute parameters with left substr", func() {
 			before := "echo $${FOO:4} IS COOL"
 			after := "echo THIS IS COOL"
-			g.Assert(substituteLeft(before, "FOO", "THIS IS A REALLY LONG STRING")).Equal(after)
+			g.Assert(substitute(before, "FOO", "THIS IS A REALLY LONG STRING")).Equal(after)
 		})
 
 		g.It("Should substitute parameters with substr", func() {
 			before := "echo $${FOO:8:5} IS COOL"
 			after := "echo DRONE IS COOL"
-			g.Assert(substituteSubstr(before, "FOO", "THIS IS DRONE CI")).Equal(after)
+			g.Assert(substitute(before, "FOO", "THIS IS DRONE CI")).Equal(after)
+		})
+
+		g.It("Should not substitute expressions that cannot be applied", func() {
+			before := "echo $${FOO:40} $${FOO#v} $${FOO/} $${FOO"
+			g.Assert(substitute(before, "FOO", "v1.0.0")).Equal(before)
+		})
+
+		g.It("Should substitute the longest parameter name", func() {
+			params := map[string]string{"COMMIT": "f36cbf5", "COMMIT_SHORT": "f36"}
+			out, _ := Substitute("echo $$COMMIT_SHORT $$COMMIT_LONG", params)
+			g.Assert(out).Equal("echo f36 f36cbf5_LONG")
+		})
+
+		g.It("Should not substitute into substituted values", func() {
+			params := map[string]string{"FOO": "$$BAR", "BAR": "BAZ"}
+			out, _ := Substitute("echo $$FOO $$BAR", params)
+			g.Assert(out).Equal("echo $$$$BAR BAZ")
+			g.Assert(Unescape(out)).Equal("echo $$BAR BAZ")
+		})
+
+		g.It("Should escape substituted values in chained substitutions", func() {
+			out, _ := Substitute("echo $$SECRET $$TOKEN $${TOKEN%%c} \"$$SECRET\"", map[string]string{"SECRET": "x$$DRONE_BRANCH", "TOKEN": "a$$$$b$$c"})
+			out, _ = Substitute(out, map[string]string{"DRONE_BRANCH": "master"})
+			g.Assert(Unescape(out)).Equal(`echo x$$DRONE_BRANCH a$$$$b$$c a$$$$b$$ "x$$DRONE_BRANCH"`)
+		})
+
+		g.It("Should keep escaped parameters", func() {
+			before := "echo $$$$FOO $$$$$$FOO $${BAR=$$$$FOO}"
+			out, _ := Substitute(before, map[string]string{"FOO": "HELLO", "BAR": ""})
+			g.Assert(out).Equal("echo $$$$FOO $$$$HELLO $$$$FOO")
+			g.Assert(Unescape(out)).Equal("echo $$FOO $$HELLO $$FOO")
+		})
+
+		g.It("Should report unknown variables", func() {
+			out, unknown := Substitute("echo $$FOO $${BAR##v} $${TAG=$$SHA} $$FOO $$$$BAZ $$", map[string]string{"TAG": "v1"})
+			g.Assert(out).Equal("echo $$FOO $${BAR##v} v1 $$FOO $$$$BAZ $$")
+			g.Assert(unknown).Equal([]string{"FOO", "BAR"})
+			g.Assert(Unknown(out)).Equal([]string{"FOO", "BAR"})
 		})
 	})
 }
+
+// substitute is a helper function that substitutes a
+// single parameter.
+func substitute(str, key, val string) string {
+	out, _ := Substitute(str, map[string]string{key: val})
+	return out
+}
@@ -0,0 +1,614 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drone/drone-exec/parser/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// Issue reports a problem found in the Yaml configuration
+// file, at the given line and column.
+type Issue struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i *Issue) Error() string {
+	return fmt.Sprintf("%d:%d: %s", i.Line, i.Column, i.Message)
+}
+
+// Lint parses the Yaml configuration file strictly and
+// returns all issues found, in order of appearance. An
+// error is returned if the file is not valid Yaml.
+func Lint(in []byte) ([]*Issue, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+	l := new(linter)
+	if len(doc.Content) != 0 {
+		l.config(doc.Content[0])
+	}
+	sort.Stable(byPosition(l.issues))
+	return l.issues, nil
+}
+
+// check defines a function used to validate the value
+// of a key in the Yaml configuration file.
+type check func(*linter, *yaml.Node)
+
+// configKeys defines the top-level keys of the Yaml.
+var configKeys = map[string]check{
+	"cache":       (*linter).cache,
+	"clone":       (*linter).plugin,
+	"build":       (*linter).build,
+	"compose":     (*linter).compose,
+	"publish":     named((*linter).plugin),
+	"deploy":      named((*linter).plugin),
+	"notify":      named((*linter).plugin),
+	"debug":       (*linter).boolean,
+	"templates":   named((*linter).plugin),
+	"version":     (*linter).version,
+	"environment": (*linter).env,
+	"defaults":    (*linter).defaults,
+	"pipeline":    (*linter).pipeline,
+}
+
+func init() {
+	// pipelines hold their own configuration, and are
+	// added here to avoid an initialization loop.
+	configKeys["pipelines"] = named((*linter).config)
+}
+
+// containerKeys defines the keys shared by all steps.
+var containerKeys = map[string]check{
+	"image":       (*linter).str,
+	"pull":        (*linter).boolean,
+	"privileged":  (*linter).boolean,
+	"environment": (*linter).env,
+	"env_file":    (*linter).strOrSlice,
+	"entrypoint":  (*linter).strOrSlice,
+	"command":     (*linter).strOrSlice,
+	"extra_hosts": (*linter).slice,
+	"volumes":     (*linter).slice,
+	"net":         (*linter).str,
+	"working_dir": (*linter).str,
+	"user":        (*linter).str,
+	"hostname":    (*linter).str,
+	"dns":         (*linter).strOrSlice,
+	"dns_search":  (*linter).strOrSlice,
+	"tmpfs":       (*linter).strOrSlice,
+	"cap_add":     (*linter).slice,
+	"cap_drop":    (*linter).slice,
+	"devices":     (*linter).slice,
+	"proxy":       (*linter).boolean,
+	"auth_config": (*linter).auth,
+	"extends":     (*linter).str,
+	"healthcheck": (*linter).healthcheck,
+}
+
+// buildKeys defines the keys of a build step.
+var buildKeys = merge(containerKeys, map[string]check{
+	"commands": (*linter).slice,
+	"when":     (*linter).filter,
+})
+
+// serviceKeys defines the keys of a compose service.
+var serviceKeys = merge(containerKeys, map[string]check{
+	"when": (*linter).filter,
+})
+
+// pluginKeys defines the keys of a plugin step. Keys not
+// listed are passed to the plugin as arguments.
+var pluginKeys = merge(containerKeys, map[string]check{
+	"when": (*linter).filter,
+})
+
+// stepKeys defines the keys of a step in the pipeline
+// section of the version 2 Yaml.
+var stepKeys = merge(containerKeys, map[string]check{
+	"name":     (*linter).str,
+	"type":     (*linter).stepType,
+	"commands": (*linter).slice,
+	"settings": (*linter).settings,
+	"when":     (*linter).filter,
+})
+
+// defaultsKeys defines the keys of the defaults section.
+var defaultsKeys = map[string]check{
+	"pull":        (*linter).boolean,
+	"volumes":     (*linter).slice,
+	"extra_hosts": (*linter).slice,
+	"net":         (*linter).str,
+	"dns":         (*linter).strOrSlice,
+	"dns_search":  (*linter).strOrSlice,
+	"auth_config": (*linter).auth,
+}
+
+// cacheKeys defines the keys of a native cache section.
+var cacheKeys = map[string]check{
+	"key":           (*linter).str,
+	"fallback_keys": (*linter).slice,
+	"paths":         (*linter).slice,
+	"max_size":      (*linter).str,
+}
+
+// filterKeys defines the keys of a when section.
+var filterKeys = map[string]check{
+	"repo":    (*linter).str,
+	"branch":  (*linter).strOrSlice,
+	"event":   (*linter).event,
+	"success": (*linter).toggle,
+	"failure": (*linter).toggle,
+	"change":  (*linter).toggle,
+	"matrix":  (*linter).stringMap,
+	"expr":    (*linter).expr,
+	"paths":   (*linter).paths,
+
+	"tag":         (*linter).strOrSlice,
+	"environment": (*linter).strOrSlice,
+}
+
+// pathsKeys defines the keys of a when paths section.
+var pathsKeys = map[string]check{
+	"include": (*linter).strOrSlice,
+	"exclude": (*linter).strOrSlice,
+}
+
+// healthcheckKeys defines the keys of a healthcheck section.
+var healthcheckKeys = map[string]check{
+	"test":     (*linter).strOrSlice,
+	"interval": (*linter).str,
+	"timeout":  (*linter).str,
+	"retries":  (*linter).str,
+}
+
+// authKeys defines the keys of an auth_config section.
+var authKeys = map[string]check{
+	"username":       (*linter).str,
+	"password":       (*linter).str,
+	"email":          (*linter).str,
+	"registry_token": (*linter).str,
+}
+
+// versions defines the versions of the Yaml.
+var versions = []string{"1", "2"}
+
+// stepTypes defines the types of steps in the pipeline
+// section of the version 2 Yaml.
+var stepTypes = []string{"clone", "cache", "service", "build", "publish", "deploy", "notify"}
+
+// events defines the build events accepted in a when
+// section.
+var events = []string{"push", "pull_request", "tag", "deployment"}
+
+// toggles defines the values accepted by the success,
+// failure and change conditions.
+var toggles = []string{
+	"true", "TRUE", "True", "On", "ON", "on",
+	"false", "FALSE", "False", "Off", "off", "OFF",
+}
+
+// booleans defines the values accepted as booleans.
+var booleans = []string{
+	"y", "Y", "yes", "Yes", "YES", "true", "True", "TRUE", "on", "On", "ON",
+	"n", "N", "no", "No", "NO", "false", "False", "FALSE", "off", "Off", "OFF",
+}
+
+type linter struct {
+	issues []*Issue
+}
+
+func (l *linter) errorf(n *yaml.Node, format string, args ...interface{}) {
+	l.issues = append(l.issues, &Issue{
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) config(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "configuration", configKeys, func(key *yaml.Node) bool {
+		return strings.HasPrefix(key.Value, "x-")
+	})
+}
+
+func (l *linter) build(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+
+	// the build section is either a single build step,
+	// or a mapping of named build steps.
+	single := false
+	each(n, func(key, val *yaml.Node) {
+		if _, ok := buildKeys[key.Value]; ok {
+			single = true
+		}
+	})
+	if single {
+		l.buildStep(n, n)
+		return
+	}
+	each(n, func(key, val *yaml.Node) {
+		l.buildStep(key, val)
+	})
+}
+
+func (l *linter) buildStep(key, n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "build step", buildKeys, nil)
+
+	// as in the parser, the image is only required if the
+	// step has commands, and may be inherited by extends.
+	commands := lookup(n, "commands")
+	if commands == nil || isNull(commands) || lookup(n, "extends") != nil {
+		return
+	}
+	if image := lookup(n, "image"); image == nil || len(image.Value) == 0 {
+		l.errorf(key, "build step must specify an image")
+	}
+}
+
+func (l *linter) service(n *yaml.Node) {
+	if n.Kind == 0 || isNull(n) {
+		return
+	}
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "service", serviceKeys, nil)
+}
+
+func (l *linter) compose(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	each(n, func(key, val *yaml.Node) {
+		// services may be imported from a docker-compose
+		// file, which is validated at runtime.
+		if key.Value == "file" && resolve(val).Kind == yaml.ScalarNode {
+			return
+		}
+		l.service(val)
+	})
+}
+
+func (l *linter) healthcheck(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "healthcheck", healthcheckKeys, nil)
+}
+
+func (l *linter) plugin(n *yaml.Node) {
+	if n.Kind == 0 || isNull(n) {
+		return
+	}
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "plugin", pluginKeys, func(*yaml.Node) bool {
+		return true // plugin arguments
+	})
+}
+
+func (l *linter) version(n *yaml.Node) {
+	if !l.expect(n, yaml.ScalarNode) {
+		return
+	}
+	if !contains(versions, n.Value) {
+		l.errorf(n, "unsupported version %q, expected one of %s", n.Value, strings.Join(versions, ", "))
+	}
+}
+
+func (l *linter) pipeline(n *yaml.Node) {
+	if !l.expect(n, yaml.SequenceNode) {
+		return
+	}
+	for _, step := range resolve(n).Content {
+		if !l.expect(step, yaml.MappingNode) {
+			continue
+		}
+		l.keys(step, "step", stepKeys, nil)
+		if lookup(step, "name") == nil {
+			l.errorf(step, "step must specify a name")
+		}
+	}
+}
+
+func (l *linter) defaults(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "defaults", defaultsKeys, nil)
+}
+
+func (l *linter) stepType(n *yaml.Node) {
+	if !l.expect(n, yaml.ScalarNode) {
+		return
+	}
+	if !contains(stepTypes, n.Value) {
+		l.errorf(n, "invalid step type %q, expected one of %s", n.Value, strings.Join(stepTypes, ", "))
+	}
+}
+
+func (l *linter) settings(n *yaml.Node) {
+	l.expect(n, yaml.MappingNode)
+}
+
+func (l *linter) cache(n *yaml.Node) {
+	// the cache section configures the native cache if
+	// paths are listed, else the cache plugin.
+	if lookup(n, "paths") == nil {
+		l.plugin(n)
+		return
+	}
+	l.keys(n, "cache", cacheKeys, nil)
+}
+
+func (l *linter) filter(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "when", filterKeys, nil)
+}
+
+func (l *linter) paths(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "paths", pathsKeys, nil)
+}
+
+func (l *linter) auth(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	l.keys(n, "auth_config", authKeys, nil)
+}
+
+func (l *linter) str(n *yaml.Node) {
+	l.expect(n, yaml.ScalarNode)
+}
+
+func (l *linter) boolean(n *yaml.Node) {
+	if !l.expect(n, yaml.ScalarNode) {
+		return
+	}
+	if !contains(booleans, n.Value) {
+		l.errorf(n, "invalid boolean %q", n.Value)
+	}
+}
+
+func (l *linter) toggle(n *yaml.Node) {
+	if !l.expect(n, yaml.ScalarNode) {
+		return
+	}
+	if !contains(toggles, n.Value) {
+		l.errorf(n, "invalid boolean %q, expected true or false", n.Value)
+	}
+}
+
+func (l *linter) event(n *yaml.Node) {
+	l.strOrSlice(n)
+	for _, v := range scalars(n) {
+		if !contains(events, v.Value) {
+			l.errorf(v, "invalid event %q, expected one of %s", v.Value, strings.Join(events, ", "))
+		}
+	}
+}
+
+func (l *linter) expr(n *yaml.Node) {
+	if !l.expect(n, yaml.ScalarNode) {
+		return
+	}
+	if _, err := expr.Parse(resolve(n).Value); err != nil {
+		l.errorf(n, "%s", err)
+	}
+}
+
+func (l *linter) slice(n *yaml.Node) {
+	if !l.expect(n, yaml.SequenceNode) {
+		return
+	}
+	for _, v := range n.Content {
+		l.expect(v, yaml.ScalarNode)
+	}
+}
+
+func (l *linter) strOrSlice(n *yaml.Node) {
+	if resolve(n).Kind == yaml.SequenceNode {
+		l.slice(n)
+		return
+	}
+	l.expect(n, yaml.ScalarNode)
+}
+
+func (l *linter) stringMap(n *yaml.Node) {
+	if !l.expect(n, yaml.MappingNode) {
+		return
+	}
+	each(n, func(key, val *yaml.Node) {
+		l.expect(val, yaml.ScalarNode)
+	})
+}
+
+func (l *linter) env(n *yaml.Node) {
+	if resolve(n).Kind == yaml.SequenceNode {
+		for _, v := range resolve(n).Content {
+			if !l.expect(v, yaml.ScalarNode) {
+				continue
+			}
+			if !strings.Contains(v.Value, "=") {
+				l.errorf(v, "invalid environment variable %q, expected KEY=VALUE", v.Value)
+			}
+		}
+		return
+	}
+	l.stringMap(n)
+}
+
+// keys is a helper function that validates each key in the
+// mapping against the known keys. Unknown keys are reported
+// unless allowed by the optional allow function.
+func (l *linter) keys(n *yaml.Node, context string, known map[string]check, allow func(*yaml.Node) bool) {
+	each(n, func(key, val *yaml.Node) {
+		fn, ok := known[key.Value]
+		switch {
+		case ok:
+			fn(l, val)
+		case allow != nil && allow(key):
+			// ignore
+		default:
+			l.errorf(key, "unknown key %q in %s", key.Value, context)
+		}
+	})
+}
+
+// expect is a helper function that reports an issue if the
+// node is not of the expected kind.
+func (l *linter) expect(n *yaml.Node, kind yaml.Kind) bool {
+	if resolve(n).Kind == kind {
+		return true
+	}
+	l.errorf(n, "expected %s, got %s", kindName(kind), kindName(resolve(n).Kind))
+	return false
+}
+
+// each is a helper function that invokes the callback for
+// each key and value in the mapping, including keys merged
+// from anchors using the << merge key.
+func each(n *yaml.Node, fn func(key, val *yaml.Node)) {
+	n = resolve(n)
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if key.Value == "<<" && key.Tag == "!!merge" {
+			for _, m := range merged(val) {
+				each(m, fn)
+			}
+			continue
+		}
+		fn(key, val)
+	}
+}
+
+// merged returns the mappings referenced by a merge key.
+func merged(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	if n.Kind == yaml.SequenceNode {
+		return n.Content
+	}
+	return []*yaml.Node{n}
+}
+
+// lookup returns the value of the key in the mapping, or
+// nil if not found.
+func lookup(n *yaml.Node, name string) (found *yaml.Node) {
+	each(n, func(key, val *yaml.Node) {
+		if key.Value == name {
+			found = resolve(val)
+		}
+	})
+	return
+}
+
+// scalars returns the scalar values of a string or slice.
+func scalars(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{n}
+	case yaml.SequenceNode:
+		var nodes []*yaml.Node
+		for _, v := range n.Content {
+			if resolve(v).Kind == yaml.ScalarNode {
+				nodes = append(nodes, resolve(v))
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+// resolve returns the node referenced by an alias.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+func isNull(n *yaml.Node) bool {
+	n = resolve(n)
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+func kindName(kind yaml.Kind) string {
+	switch kind {
+	case yaml.ScalarNode:
+		return "a value"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.MappingNode:
+		return "a mapping"
+	}
+	return "nothing"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// named returns a check that validates a mapping of
+// named steps using the given check.
+func named(fn check) check {
+	return func(l *linter, n *yaml.Node) {
+		if !l.expect(n, yaml.MappingNode) {
+			return
+		}
+		each(n, func(key, val *yaml.Node) {
+			fn(l, val)
+		})
+	}
+}
+
+// merge returns a new map with the keys of both maps.
+func merge(a, b map[string]check) map[string]check {
+	c := map[string]check{}
+	for k, v := range a {
+		c[k] = v
+	}
+	for k, v := range b {
+		c[k] = v
+	}
+	return c
+}
+
+type byPosition []*Issue
+
+func (s byPosition) Len() int      { return len(s) }
+func (s byPosition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPosition) Less(i, j int) bool {
+	if s[i].Line != s[j].Line {
+		return s[i].Line < s[j].Line
+	}
+	return s[i].Column < s[j].Column
+}
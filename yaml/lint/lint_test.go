@@ -0,0 +1,132 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestLint(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Lint Yaml", func() {
+
+		g.It("Should not report issues for a valid Yaml", func() {
+			issues, err := Lint([]byte(valid))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(issues)).Equal(0)
+		})
+
+		g.It("Should report issues with line and column", func() {
+			issues, err := Lint([]byte(invalid))
+			g.Assert(err == nil).IsTrue()
+
+			var got []string
+			for _, issue := range issues {
+				got = append(got, issue.Error())
+			}
+			g.Assert(got).Equal([]string{
+				`3:3: unknown key "comands" in build step`,
+				`5:9: invalid boolean "maybe"`,
+				`8:14: expected a list, got a mapping`,
+				`11:13: unknown key "brach" in when`,
+				`12:16: invalid event "pull", expected one of push, pull_request, tag, deployment`,
+				`13:16: invalid boolean "sometimes", expected true or false`,
+				`15:19: invalid expression "branch = main": column 8: unexpected character '='`,
+			})
+		})
+
+		g.It("Should only require an image for build steps with commands", func() {
+			issues, err := Lint([]byte("build:\n  pull: true\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(issues)).Equal(0)
+
+			issues, err = Lint([]byte("build:\n  commands: [ go test ]\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(issues)).Equal(1)
+			g.Assert(issues[0].Error()).Equal(`2:3: build step must specify an image`)
+		})
+
+		g.It("Should lint named pipelines", func() {
+			issues, err := Lint([]byte("pipelines:\n  docs:\n    biuld: { image: node }\n"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(issues)).Equal(1)
+			g.Assert(issues[0].Error()).Equal(`3:5: unknown key "biuld" in configuration`)
+		})
+
+		g.It("Should lint the pipeline section", func() {
+			issues, err := Lint([]byte("version: 3\npipeline:\n  - image: golang\n  - name: slack\n    type: notfiy\n    settings: [ dev ]\n"))
+			g.Assert(err == nil).IsTrue()
+
+			var got []string
+			for _, issue := range issues {
+				got = append(got, issue.Error())
+			}
+			g.Assert(got).Equal([]string{
+				`1:10: unsupported version "3", expected one of 1, 2`,
+				`3:5: step must specify a name`,
+				`5:11: invalid step type "notfiy", expected one of clone, cache, service, build, publish, deploy, notify`,
+				`6:15: expected a mapping, got a list`,
+			})
+		})
+
+		g.It("Should return an error for malformed Yaml", func() {
+			_, err := Lint([]byte("build: [ golang"))
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
+
+var valid = `
+x-golang: &golang
+  image: golang
+clone:
+  path: github.com/octocat/hello-world
+build:
+  backend:
+    <<: *golang
+    commands: [ go test ]
+    environment:
+      GO15VENDOREXPERIMENT: 1
+    env_file: [ ci.env ]
+compose:
+  file: docker-compose.ci.yml
+  redis:
+    command: redis-server --appendonly yes
+    healthcheck:
+      test: [ CMD, redis-cli, ping ]
+      retries: 5
+  elasticsearch:
+    image: elasticsearch:2
+    when:
+      matrix:
+        SUITE: integration
+deploy:
+  heroku:
+    app: foo.com
+    when:
+      branch: master
+      event: [ push, tag ]
+      success: true
+      expr: event == "push" || event == "tag"
+      paths:
+        include: [ api/** ]
+        exclude: "**/*.md"
+`
+
+var invalid = `
+build:
+  comands:
+    - go test
+  pull: maybe
+compose:
+  redis:
+    volumes: { a: b }
+notify:
+  slack:
+    when: { brach: master,
+      event: [ pull ],
+      failure: sometimes }
+  email:
+    when: { expr: 'branch = main' }
+`
@@ -0,0 +1,311 @@
+package yaml
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MarshalYAML implements the Marshaller interface. Sections
+// and steps are written in order, and empty values are
+// omitted.
+func (c Config) MarshalYAML() (interface{}, error) {
+	var m mapSlice
+	if c.Version != 0 {
+		m.add("version", c.Version)
+	}
+	m.add("debug", c.Debug)
+	m.add("environment", c.Environment.parts)
+	m.add("defaults", c.Defaults.marshal())
+	m.add("cache", c.Cache.marshal())
+	m.add("clone", c.Clone.marshal())
+	m.add("compose", c.Compose.marshal())
+	m.add("build", c.Build.marshal())
+	m.add("publish", c.Publish.marshal())
+	m.add("deploy", c.Deploy.marshal())
+	m.add("notify", c.Notify.marshal())
+	if len(c.Pipeline.parts) != 0 {
+		m.add("pipeline", c.Pipeline.marshal())
+	}
+	return yaml.MapSlice(m), nil
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (c Container) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(c.marshal()), nil
+}
+
+func (c *Container) marshal() mapSlice {
+	var m mapSlice
+	if c.Image != c.Name {
+		m.add("image", c.Image)
+	}
+	m.add("pull", c.Pull)
+	m.add("privileged", c.Privileged)
+	m.add("environment", c.Environment.parts)
+	m.add("env_file", c.EnvFile.parts)
+	m.add("entrypoint", c.Entrypoint.parts)
+	m.add("command", c.Command.parts)
+	m.add("extra_hosts", c.ExtraHosts)
+	m.add("volumes", c.Volumes)
+	m.add("net", c.Net)
+	m.add("working_dir", c.WorkingDir)
+	m.add("user", c.User)
+	m.add("hostname", c.Hostname)
+	m.add("dns", c.DNS.parts)
+	m.add("dns_search", c.DNSSearch.parts)
+	m.add("tmpfs", c.Tmpfs.parts)
+	m.add("cap_add", c.CapAdd)
+	m.add("cap_drop", c.CapDrop)
+	m.add("devices", c.Devices)
+	if c.Proxy != nil {
+		m = append(m, yaml.MapItem{Key: "proxy", Value: *c.Proxy})
+	}
+	if c.AuthConfig != (AuthConfig{}) {
+		m.add("auth_config", c.AuthConfig)
+	}
+	if c.Healthcheck != nil {
+		m.add("healthcheck", c.Healthcheck.marshal())
+	}
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (h Healthcheck) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(h.marshal()), nil
+}
+
+func (h *Healthcheck) marshal() mapSlice {
+	var m mapSlice
+	m.add("test", h.Test.parts)
+	m.add("interval", h.Interval)
+	m.add("timeout", h.Timeout)
+	if h.Retries != 0 {
+		m.add("retries", h.Retries)
+	}
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (b Build) MarshalYAML() (interface{}, error) {
+	m := b.Container.marshal()
+	m.add("commands", b.Commands)
+	m.add("when", b.Filter.marshal())
+	return yaml.MapSlice(m), nil
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (s Service) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(s.marshal()), nil
+}
+
+func (s *Service) marshal() mapSlice {
+	m := s.Container.marshal()
+	m.add("when", s.Filter.marshal())
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface. Plugin
+// arguments are written in alphabetical order.
+func (p Plugin) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(p.marshal()), nil
+}
+
+func (p *Plugin) marshal() mapSlice {
+	m := p.Container.marshal()
+	var keys []string
+	for key := range p.Vargs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m = append(m, yaml.MapItem{Key: key, Value: p.Vargs[key]})
+	}
+	m.add("when", p.Filter.marshal())
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (d Defaults) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(d.marshal()), nil
+}
+
+func (d *Defaults) marshal() mapSlice {
+	var m mapSlice
+	m.add("pull", d.Pull)
+	m.add("volumes", d.Volumes)
+	m.add("extra_hosts", d.ExtraHosts)
+	m.add("net", d.Net)
+	m.add("dns", d.DNS.parts)
+	m.add("dns_search", d.DNSSearch.parts)
+	if d.AuthConfig != (AuthConfig{}) {
+		m.add("auth_config", d.AuthConfig)
+	}
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface. The name
+// and type are written first, and the image is always written.
+func (s Step) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(s.marshal()), nil
+}
+
+func (s *Step) marshal() mapSlice {
+	var m mapSlice
+	m.add("name", s.Name)
+	m.add("type", s.Type)
+	m.add("image", s.Image)
+	for _, item := range s.Container.marshal() {
+		if item.Key != "image" {
+			m = append(m, item)
+		}
+	}
+	m.add("commands", s.Commands)
+	if len(s.Settings) != 0 {
+		m.add("settings", s.Settings)
+	}
+	m.add("when", s.Filter.marshal())
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (s Steps) MarshalYAML() (interface{}, error) {
+	return s.marshal(), nil
+}
+
+func (s *Steps) marshal() []yaml.MapSlice {
+	var steps []yaml.MapSlice
+	for i := range s.parts {
+		steps = append(steps, yaml.MapSlice(s.parts[i].marshal()))
+	}
+	return steps
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (f Filter) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(f.marshal()), nil
+}
+
+func (f *Filter) marshal() mapSlice {
+	var m mapSlice
+	m.add("repo", f.Repo)
+	m.add("branch", f.Branch.parts)
+	m.add("event", f.Event.parts)
+	m.add("success", f.Success)
+	m.add("failure", f.Failure)
+	m.add("change", f.Change)
+	m.add("matrix", f.Matrix)
+	m.add("expr", f.Expr)
+	var paths mapSlice
+	paths.add("include", f.Paths.Include.parts)
+	paths.add("exclude", f.Paths.Exclude.parts)
+	m.add("paths", paths)
+	m.add("tag", f.Tag.parts)
+	m.add("environment", f.Environment.parts)
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (s Command) MarshalYAML() (interface{}, error) {
+	return s.parts, nil
+}
+
+// MarshalYAML implements the Marshaller interface.
+func (s MapEqualSlice) MarshalYAML() (interface{}, error) {
+	return s.parts, nil
+}
+
+// MarshalYAML implements the Marshaller interface. Named
+// plugins are written as a mapping, in order.
+func (s Pluginslice) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(s.marshal()), nil
+}
+
+func (s *Pluginslice) marshal() mapSlice {
+	var m mapSlice
+	for i := range s.parts {
+		p := &s.parts[i]
+		m = append(m, yaml.MapItem{Key: stepName(&p.Container), Value: yaml.MapSlice(p.marshal())})
+	}
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface. Named
+// containers are written as a mapping, in order.
+func (s Containerslice) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(s.marshal()), nil
+}
+
+func (s *Containerslice) marshal() mapSlice {
+	var m mapSlice
+	m.add("file", s.file)
+	for i := range s.parts {
+		c := &s.parts[i]
+		m = append(m, yaml.MapItem{Key: stepName(&c.Container), Value: yaml.MapSlice(c.marshal())})
+	}
+	return m
+}
+
+// MarshalYAML implements the Marshaller interface. A single
+// unnamed build step is written as a mapping of its keys,
+// else named build steps are written as a mapping, in order.
+func (s BuildStep) MarshalYAML() (interface{}, error) {
+	return s.marshal(), nil
+}
+
+func (s *BuildStep) marshal() interface{} {
+	if len(s.parts) == 1 && len(s.parts[0].Name) == 0 {
+		v, _ := s.parts[0].MarshalYAML()
+		return v
+	}
+	var m mapSlice
+	for _, b := range s.parts {
+		v, _ := b.MarshalYAML()
+		m = append(m, yaml.MapItem{Key: stepName(&b.Container), Value: v})
+	}
+	return yaml.MapSlice(m)
+}
+
+// stepName is a helper function that returns the key of a
+// named step, defaulting to the image name.
+func stepName(c *Container) string {
+	if len(c.Name) != 0 {
+		return c.Name
+	}
+	return c.Image
+}
+
+type mapSlice yaml.MapSlice
+
+// add appends the key and value to the mapping, unless the
+// value is empty.
+func (m *mapSlice) add(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if len(v) == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case map[string]string:
+		if len(v) == 0 {
+			return
+		}
+	case mapSlice:
+		if len(v) == 0 {
+			return
+		}
+		value = yaml.MapSlice(v)
+	case yaml.MapSlice:
+		if len(v) == 0 {
+			return
+		}
+	}
+	*m = append(*m, yaml.MapItem{Key: key, Value: value})
+}
@@ -0,0 +1,80 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMarshal(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Marshal Yaml", func() {
+
+		g.It("Should marshal the configuration in order", func() {
+			conf, err := ParseString(sampleMarshal)
+			g.Assert(err == nil).IsTrue()
+			out, err := yaml.Marshal(conf)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out)).Equal(sampleMarshalOutput)
+		})
+
+		g.It("Should round-trip the configuration", func() {
+			conf, _ := ParseString(sample)
+			out, err := yaml.Marshal(conf)
+			g.Assert(err == nil).IsTrue()
+			again, err := Parse(out)
+			g.Assert(err == nil).IsTrue()
+			out2, _ := yaml.Marshal(again)
+			g.Assert(string(out2)).Equal(string(out))
+			g.Assert(again.Build.Slice()[0].Commands).Equal(conf.Build.Slice()[0].Commands)
+			g.Assert(again.Clone.Vargs["path"]).Equal(conf.Clone.Vargs["path"])
+		})
+	})
+}
+
+var sampleMarshal = `
+debug: true
+build:
+  image: golang
+  commands: [ go test ]
+  when:
+    branch: master
+compose:
+  redis:
+    command: redis-server --appendonly yes
+  db:
+    image: mysql
+notify:
+  slack:
+    channel: dev
+  email:
+    image: plugins/email
+    recipients: [ octocat@github.com ]
+`
+
+var sampleMarshalOutput = `debug: true
+compose:
+  redis:
+    command:
+    - redis-server
+    - --appendonly
+    - "yes"
+  db:
+    image: mysql
+build:
+  image: golang
+  commands:
+  - go test
+  when:
+    branch:
+    - master
+notify:
+  slack:
+    channel: dev
+  email:
+    image: plugins/email
+    recipients:
+    - octocat@github.com
+`
@@ -1,12 +1,38 @@
 package yaml
 
-import "gopkg.in/yaml.v2"
+import (
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
 
-// Parse parses a Yaml configuraiton file.
+// Parse parses a Yaml configuraiton file. Steps extending
+// a template are merged with the template before parsing.
+// The position of each step is recorded, and errors report
+// the position in the Yaml, if known.
 func Parse(in []byte) (*Config, error) {
+	return parse(in, parseNode(in))
+}
+
+// parse is a helper function that parses the Yaml, using
+// the mappings of the source file to record positions.
+func parse(in []byte, roots ...*yamlv3.Node) (*Config, error) {
 	c := Config{}
-	e := yaml.Unmarshal(in, &c)
-	return &c, e
+	out, e := expand(in)
+	if e != nil {
+		return &c, e
+	}
+	var nodes []*yamlv3.Node
+	for _, root := range roots {
+		if root != nil {
+			nodes = append(nodes, root)
+		}
+	}
+	e = yaml.Unmarshal(out, &c)
+	if e != nil {
+		return &c, locate(e, out, nodes...)
+	}
+	annotate(&c, nodes...)
+	return &c, validate(&c)
 }
 
 // ParseString parses a Yaml configuration file
@@ -31,3 +57,25 @@ func ParseDebug(in []byte) bool {
 func ParseDebugString(in string) bool {
 	return ParseDebug([]byte(in))
 }
+
+// ParseCache parses a Yaml configuration file in order
+// to extract the native cache section. If the cache section
+// does not list any paths, it is configured for the cache
+// plugin, and nil is returned.
+func ParseCache(in []byte) *Cache {
+	var c = struct {
+		Cache *Cache
+	}{}
+	yaml.Unmarshal(in, &c)
+	if c.Cache == nil || len(c.Cache.Paths) == 0 {
+		return nil
+	}
+	return c.Cache
+}
+
+// ParseCacheString parses a Yaml configuration file in
+// string format in order to extract the native cache
+// section.
+func ParseCacheString(in string) *Cache {
+	return ParseCache([]byte(in))
+}
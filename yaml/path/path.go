@@ -20,6 +20,15 @@ type config struct {
 	Clone struct {
 		Path string
 	}
+
+	// Pipeline lists the steps of the version 2 Yaml, where
+	// the path is a setting of the clone step.
+	Pipeline []struct {
+		Type     string
+		Settings struct {
+			Path string
+		}
+	}
 }
 
 // Parse parses a yaml file to find the default
@@ -37,6 +46,11 @@ func Parse(raw, rawurl string) string {
 	if len(data.Clone.Path) != 0 {
 		path = data.Clone.Path
 	}
+	for _, step := range data.Pipeline {
+		if step.Type == "clone" && len(step.Settings.Path) != 0 {
+			path = step.Settings.Path
+		}
+	}
 
 	if filepath.HasPrefix(path, DefaultRoot) {
 		return path
@@ -16,6 +16,11 @@ func Test_Parse(t *testing.T) {
 			g.Assert(p).Equal("/drone/src/github.com/octocat/hello-world")
 		})
 
+		g.It("Should return the clone path of a version 2 Yaml", func() {
+			p := Parse("version: 2\npipeline:\n  - name: clone\n    type: clone\n    settings: { path: github.com/octocat/hello-world }\n", "http://github.com/foo/bar")
+			g.Assert(p).Equal("/drone/src/github.com/octocat/hello-world")
+		})
+
 		g.It("Should handle missing clone path", func() {
 			p := Parse(sampleEmpty, "http://github.com/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/foo/bar")
@@ -0,0 +1,97 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// nameRegexp defines the valid pipeline names, which are used
+// as directory names.
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Pipeline is a pipeline declared in the Yaml configuration
+// file, holding its own clone, compose, build, publish,
+// deploy and notify sections.
+type Pipeline struct {
+	Name string // empty for the default pipeline
+	Yaml string // configuration of the pipeline
+
+	// roots are the mappings of the source file used to
+	// record the position of each step.
+	roots []*yamlv3.Node
+}
+
+// Parse parses the configuration of the pipeline, recording
+// positions in the source Yaml file.
+func (p *Pipeline) Parse() (*Config, error) {
+	if len(p.roots) == 0 {
+		return ParseString(p.Yaml)
+	}
+	return parse([]byte(p.Yaml), p.roots...)
+}
+
+// ParsePipelines parses a Yaml configuration file in order
+// to extract the pipelines declared in the pipelines section,
+// in order of appearance. Top-level keys are shared by each
+// pipeline, unless declared by the pipeline. If there is no
+// pipelines section a single unnamed pipeline is returned.
+func ParsePipelines(in []byte) ([]*Pipeline, error) {
+	single := []*Pipeline{{Yaml: string(in)}}
+	if !bytes.Contains(in, []byte("pipelines")) {
+		return single, nil
+	}
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+	value, ok := lookup(doc, "pipelines")
+	if !ok {
+		return single, nil
+	}
+	named, ok := value.(yaml.MapSlice)
+	if !ok || len(named) == 0 {
+		return nil, fmt.Errorf("pipelines must be a mapping of named pipelines")
+	}
+
+	var root = parseNode(in)
+	var _, nodes = lookupNode(root, "pipelines")
+
+	var pipelines []*Pipeline
+	for _, item := range named {
+		name := fmt.Sprint(item.Key)
+		if !nameRegexp.MatchString(name) || name == "." || name == ".." {
+			return nil, fmt.Errorf("pipeline %q must be named using letters, digits, dots, dashes and underscores", name)
+		}
+		conf, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("pipeline %s must be a mapping", name)
+		}
+		for _, shared := range doc {
+			key := fmt.Sprint(shared.Key)
+			if _, ok := lookup(conf, key); !ok && key != "pipelines" {
+				conf = append(conf, shared)
+			}
+		}
+		out, err := yaml.Marshal(conf)
+		if err != nil {
+			return nil, err
+		}
+		_, node := lookupNode(nodes, name)
+		pipelines = append(pipelines, &Pipeline{
+			Name:  name,
+			Yaml:  string(out),
+			roots: []*yamlv3.Node{node, root},
+		})
+	}
+	return pipelines, nil
+}
+
+// ParsePipelinesString parses a Yaml configuration file
+// in string format in order to extract the pipelines.
+func ParsePipelinesString(in string) ([]*Pipeline, error) {
+	return ParsePipelines([]byte(in))
+}
@@ -0,0 +1,70 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestPipelines(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Pipelines", func() {
+
+		g.It("Should return a single pipeline by default", func() {
+			pipelines, err := ParsePipelinesString(sample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(pipelines)).Equal(1)
+			g.Assert(pipelines[0].Name).Equal("")
+			g.Assert(pipelines[0].Yaml).Equal(sample)
+		})
+
+		g.It("Should parse named pipelines in order", func() {
+			pipelines, err := ParsePipelinesString(samplePipelines)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(pipelines)).Equal(2)
+			g.Assert(pipelines[0].Name).Equal("backend")
+			g.Assert(pipelines[1].Name).Equal("docs")
+
+			backend, _ := ParseString(pipelines[0].Yaml)
+			g.Assert(backend.Build.Slice()[0].Image).Equal("golang")
+			g.Assert(backend.Clone.Vargs["depth"]).Equal(1)
+
+			docs, _ := ParseString(pipelines[1].Yaml)
+			g.Assert(docs.Build.Slice()[0].Image).Equal("node")
+			g.Assert(docs.Clone.Vargs["depth"]).Equal(50)
+		})
+
+		g.It("Should reject invalid pipelines", func() {
+			_, err := ParsePipelinesString("pipelines: [ backend ]")
+			g.Assert(err.Error()).Equal("pipelines must be a mapping of named pipelines")
+			_, err = ParsePipelinesString("pipelines: { backend: golang }")
+			g.Assert(err.Error()).Equal("pipeline backend must be a mapping")
+		})
+
+		g.It("Should reject invalid pipeline names", func() {
+			for _, name := range []string{"../../etc/cron.d", "..", ".", "back end", "''"} {
+				_, err := ParsePipelinesString("pipelines: { " + name + ": { build: { image: golang } } }")
+				g.Assert(err == nil).IsFalse()
+			}
+			_, err := ParsePipelinesString("pipelines: { ../logs: { build: { image: golang } } }")
+			g.Assert(err.Error()).Equal(`pipeline "../logs" must be named using letters, digits, dots, dashes and underscores`)
+		})
+	})
+}
+
+var samplePipelines = `
+clone:
+  depth: 1
+pipelines:
+  backend:
+    build:
+      image: golang
+      commands: [ go test ]
+  docs:
+    clone:
+      depth: 50
+    build:
+      image: node
+      commands: [ npm run docs ]
+`
@@ -0,0 +1,372 @@
+package yaml
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// File is the name of the Yaml configuration file used
+// when reporting positions.
+var File = ".drone.yml"
+
+// Position is the line and column of a key in the Yaml
+// configuration file. A zero Position is unknown.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid returns true if the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	switch {
+	case !p.IsValid():
+		return File
+	case p.Column == 0:
+		return fmt.Sprintf("%s:%d", File, p.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", File, p.Line, p.Column)
+}
+
+// Error reports an error parsing the Yaml configuration
+// file at the given position.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+var lineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// toError is a helper function that converts a Yaml error
+// to an *Error with the position of the error. Errors of
+// unknown position are returned unchanged.
+func toError(err error) error {
+	msg := err.Error()
+	if te, ok := err.(*yaml.TypeError); ok && len(te.Errors) == 1 {
+		msg = te.Errors[0]
+	}
+	if m := lineRegexp.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &Error{Pos: Position{Line: line}, Msg: m[2]}
+	}
+	return err
+}
+
+// fragmentError is an error unmarshalling the value of a key,
+// which is re-marshalled by a custom unmarshal function. The
+// line of the error is relative to the fragment.
+type fragmentError struct {
+	key  string
+	frag []byte
+	err  error
+}
+
+func (e *fragmentError) Error() string {
+	return e.err.Error()
+}
+
+// locate is a helper function that converts a Yaml error to an
+// *Error with the position of the error in the source Yaml file.
+// The Yaml that failed to unmarshal may be expanded, or a fragment
+// re-marshalled by a custom unmarshal function, so the line of the
+// error is converted to the path of the failing node, which is then
+// looked up in the mappings of the source Yaml file.
+func locate(err error, out []byte, roots ...*yamlv3.Node) error {
+	var path []string
+	doc := out
+	if fe, ok := err.(*fragmentError); ok {
+		path = append(path, failingSection(out))
+		for fe != nil {
+			path = append(path, fe.key)
+			doc, err = fe.frag, fe.err
+			fe, _ = err.(*fragmentError)
+		}
+	}
+	e, ok := toError(err).(*Error)
+	if !ok || len(roots) == 0 {
+		return toError(err)
+	}
+	path = append(path, linePath(parseNode(doc), e.Pos.Line)...)
+	if n := findNode(roots, path); n != nil {
+		e.Pos = Position{Line: n.Line}
+	}
+	return e
+}
+
+// failingSection is a helper function that returns the key of
+// the top-level section of the Yaml that fails to unmarshal.
+func failingSection(in []byte) string {
+	doc := yaml.MapSlice{}
+	if yaml.Unmarshal(in, &doc) != nil {
+		return ""
+	}
+	for _, item := range doc {
+		out, err := yaml.Marshal(yaml.MapSlice{item})
+		if err == nil && yaml.Unmarshal(out, &Config{}) != nil {
+			return fmt.Sprint(item.Key)
+		}
+	}
+	return ""
+}
+
+// linePath is a helper function that returns the path to the
+// deepest node of the Yaml starting at or before the line, as
+// the keys of mappings and the indexes of sequences.
+func linePath(n *yamlv3.Node, line int) []string {
+	var path []string
+	for n != nil {
+		var key string
+		var next *yamlv3.Node
+		switch n.Kind {
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Line <= line {
+					key, next = n.Content[i].Value, n.Content[i+1]
+				}
+			}
+		case yamlv3.SequenceNode:
+			for i, item := range n.Content {
+				if item.Line <= line {
+					key, next = strconv.Itoa(i), item
+				}
+			}
+		}
+		if next == nil {
+			break
+		}
+		path = append(path, key)
+		n = next
+	}
+	return path
+}
+
+// findNode is a helper function that returns the deepest node
+// of the path in the mappings of the source Yaml file. Keys
+// missing from a step are looked up in the template it extends.
+func findNode(roots []*yamlv3.Node, path []string) *yamlv3.Node {
+	if len(path) == 0 {
+		return nil
+	}
+	var n *yamlv3.Node
+	for _, root := range roots {
+		if _, val := lookupNode(root, path[0]); val != nil {
+			n = val
+			break
+		}
+	}
+	for i := 1; n != nil && i < len(path); i++ {
+		next := childNode(roots, n, path[i])
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n
+}
+
+// childNode is a helper function that returns the value of
+// the key of a mapping, or the item of a sequence.
+func childNode(roots []*yamlv3.Node, n *yamlv3.Node, key string) *yamlv3.Node {
+	n = resolveNode(n)
+	switch n.Kind {
+	case yamlv3.SequenceNode:
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 && i < len(n.Content) {
+			return n.Content[i]
+		}
+	case yamlv3.MappingNode:
+		if _, val := lookupNode(n, key); val != nil {
+			return val
+		}
+		if _, name := lookupNode(n, "extends"); name != nil {
+			if tmpl := templateNode(roots, name.Value); tmpl != nil && tmpl != n {
+				return childNode(roots, tmpl, key)
+			}
+		}
+	}
+	return nil
+}
+
+// templateNode is a helper function that returns the step
+// definition of the named template, declared in the templates
+// section or in a top-level x- key.
+func templateNode(roots []*yamlv3.Node, name string) *yamlv3.Node {
+	for _, root := range roots {
+		_, templates := lookupNode(root, "templates")
+		if _, val := lookupNode(templates, name); val != nil {
+			return resolveNode(val)
+		}
+		if strings.HasPrefix(name, "x-") {
+			if _, val := lookupNode(root, name); val != nil {
+				return resolveNode(val)
+			}
+		}
+	}
+	return nil
+}
+
+// annotate is a helper function that records the position
+// of each step, its keys and its when section, using the
+// mappings of the Yaml configuration file. Keys missing from
+// the first mapping are looked up in the following mappings.
+func annotate(c *Config, roots ...*yamlv3.Node) {
+	section := func(name string) (key, val *yamlv3.Node) {
+		for _, root := range roots {
+			if key, val := lookupNode(root, name); key != nil {
+				return key, val
+			}
+		}
+		return nil, nil
+	}
+
+	if key, val := section("cache"); key != nil {
+		annotateContainer(&c.Cache.Container, &c.Cache.Filter, key, val)
+	}
+	if key, val := section("clone"); key != nil {
+		annotateContainer(&c.Clone.Container, &c.Clone.Filter, key, val)
+	}
+	if key, val := section("build"); key != nil {
+		builds := c.Build.parts
+		if len(builds) == 1 && len(pairs(val)) != 0 && isBuildStep(val) {
+			annotateContainer(&builds[0].Container, &builds[0].Filter, key, val)
+		} else {
+			for i, pair := range pairs(val) {
+				if i < len(builds) {
+					annotateContainer(&builds[i].Container, &builds[i].Filter, pair[0], pair[1])
+				}
+			}
+		}
+	}
+	if key, val := section("compose"); key != nil {
+		var i int
+		for _, pair := range pairs(val) {
+			if pair[0].Value == "file" && resolveNode(pair[1]).Kind == yamlv3.ScalarNode {
+				continue // imported docker-compose file
+			}
+			if i < len(c.Compose.parts) {
+				s := &c.Compose.parts[i]
+				annotateContainer(&s.Container, &s.Filter, pair[0], pair[1])
+			}
+			i++
+		}
+	}
+	if _, val := section("pipeline"); val != nil {
+		val = resolveNode(val)
+		for i, item := range val.Content {
+			if i < len(c.Pipeline.parts) && val.Kind == yamlv3.SequenceNode {
+				step := &c.Pipeline.parts[i]
+				annotateContainer(&step.Container, &step.Filter, item, item)
+			}
+		}
+	}
+	for name, plugins := range map[string]*Pluginslice{
+		"publish": &c.Publish,
+		"deploy":  &c.Deploy,
+		"notify":  &c.Notify,
+	} {
+		if key, val := section(name); key != nil {
+			for i, pair := range pairs(val) {
+				if i < len(plugins.parts) {
+					p := &plugins.parts[i]
+					annotateContainer(&p.Container, &p.Filter, pair[0], pair[1])
+				}
+			}
+		}
+	}
+}
+
+// annotateContainer is a helper function that records the
+// position of the step, its keys and its when section.
+func annotateContainer(c *Container, f *Filter, key, val *yamlv3.Node) {
+	c.Pos = nodePosition(key)
+	c.Keys = map[string]Position{}
+	for _, pair := range pairs(val) {
+		c.Keys[pair[0].Value] = nodePosition(pair[0])
+	}
+	if f == nil {
+		return
+	}
+	f.Pos = c.Pos
+	if pos, ok := c.Keys["when"]; ok {
+		f.Pos = pos
+	}
+}
+
+// isBuildStep is a helper function that returns true if the
+// build section is a single build step.
+func isBuildStep(n *yamlv3.Node) bool {
+	image, _ := lookupNode(n, "image")
+	extends, _ := lookupNode(n, "extends")
+	return image != nil || extends != nil
+}
+
+// pairs is a helper function that returns the keys and
+// values of the mapping, including merged keys.
+func pairs(n *yamlv3.Node) [][2]*yamlv3.Node {
+	n = resolveNode(n)
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	var out [][2]*yamlv3.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if key.Value == "<<" && key.Tag == "!!merge" {
+			merged := resolveNode(val)
+			if merged.Kind == yamlv3.SequenceNode {
+				for _, m := range merged.Content {
+					out = append(out, pairs(m)...)
+				}
+			} else {
+				out = append(out, pairs(merged)...)
+			}
+			continue
+		}
+		out = append(out, [2]*yamlv3.Node{key, val})
+	}
+	return out
+}
+
+// lookupNode is a helper function that returns the key and
+// value of the named key in the mapping.
+func lookupNode(n *yamlv3.Node, name string) (key, val *yamlv3.Node) {
+	for _, pair := range pairs(n) {
+		if pair[0].Value == name {
+			key, val = pair[0], pair[1]
+		}
+	}
+	return
+}
+
+func resolveNode(n *yamlv3.Node) *yamlv3.Node {
+	for n != nil && n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+func nodePosition(n *yamlv3.Node) Position {
+	return Position{Line: n.Line, Column: n.Column}
+}
+
+// parseNode is a helper function that parses the Yaml
+// configuration file to a document node, returning the
+// root mapping, or nil if the Yaml cannot be parsed.
+func parseNode(in []byte) *yamlv3.Node {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(in, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	return doc.Content[0]
+}
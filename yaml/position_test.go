@@ -0,0 +1,131 @@
+package yaml
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestPosition(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Positions", func() {
+
+		g.It("Should record the position of each step", func() {
+			conf, err := ParseString(samplePositions)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Clone.Pos.String()).Equal(".drone.yml:2:1")
+			g.Assert(conf.Build.Slice()[0].Pos.String()).Equal(".drone.yml:5:3")
+			g.Assert(conf.Build.Slice()[1].Pos.String()).Equal(".drone.yml:8:3")
+			g.Assert(conf.Compose.Slice()[0].Pos.String()).Equal(".drone.yml:14:3")
+			g.Assert(conf.Notify.Slice()[0].Pos.String()).Equal(".drone.yml:17:3")
+		})
+
+		g.It("Should record the position of each key", func() {
+			conf, _ := ParseString(samplePositions)
+			build := conf.Build.Slice()[1]
+			g.Assert(build.Keys["image"].String()).Equal(".drone.yml:9:5")
+			g.Assert(build.Keys["commands"].String()).Equal(".drone.yml:10:5")
+			g.Assert(conf.Notify.Slice()[0].Keys["channel"].String()).Equal(".drone.yml:18:5")
+		})
+
+		g.It("Should record the position of the when section", func() {
+			conf, _ := ParseString(samplePositions)
+			g.Assert(conf.Build.Slice()[1].Filter.Pos.String()).Equal(".drone.yml:11:5")
+			g.Assert(conf.Notify.Slice()[0].Filter.Pos.String()).Equal(".drone.yml:17:3")
+		})
+
+		g.It("Should record positions of a single build step", func() {
+			conf, _ := ParseString("build:\n  image: golang\n  commands: [ go test ]\n")
+			g.Assert(conf.Build.Slice()[0].Pos.String()).Equal(".drone.yml:1:1")
+			g.Assert(conf.Build.Slice()[0].Keys["commands"].String()).Equal(".drone.yml:3:3")
+		})
+
+		g.It("Should record positions of named pipelines", func() {
+			pipelines, _ := ParsePipelinesString(samplePipelines)
+			conf, err := pipelines[1].Parse()
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Clone.Pos.String()).Equal(".drone.yml:10:5")
+			g.Assert(conf.Build.Slice()[0].Pos.String()).Equal(".drone.yml:12:5")
+
+			conf, _ = pipelines[0].Parse()
+			g.Assert(conf.Clone.Pos.String()).Equal(".drone.yml:2:1")
+		})
+
+		g.It("Should report the position of errors", func() {
+			_, err := ParseString("build:\n  image: golang\n commands: [ go test ]\n")
+			g.Assert(err.Error()).Equal(".drone.yml:2: did not find expected key")
+			_, err = ParseString("build:\n  image: golang\n  pull: [ true ]\n")
+			g.Assert(err.Error()).Equal(".drone.yml:3: cannot unmarshal !!seq into bool")
+			g.Assert(toError(errors.New("unknown")).Error()).Equal("unknown")
+		})
+
+		g.It("Should report the position of errors in named steps", func() {
+			_, err := ParseString(sampleStepError)
+			g.Assert(err.Error()).Equal(".drone.yml:13: cannot unmarshal !!str `maybe` into bool")
+			_, err = ParseString("pipeline:\n  - name: test\n    image: golang\n\n    pull: maybe\n")
+			g.Assert(err.Error()).Equal(".drone.yml:5: cannot unmarshal !!str `maybe` into bool")
+
+			pipelines, _ := ParsePipelinesString("pipelines:\n  backend:\n    publish:\n      docker:\n        pull: maybe\n")
+			_, err = pipelines[0].Parse()
+			g.Assert(err.Error()).Equal(".drone.yml:5: cannot unmarshal !!str `maybe` into bool")
+		})
+
+		g.It("Should report the position of errors in extended steps", func() {
+			_, err := ParseString(sampleExtendsError)
+			g.Assert(err.Error()).Equal(".drone.yml:12: cannot unmarshal !!str `maybe` into bool")
+			_, err = ParseString("x-go:\n  image: golang\n  pull: maybe\nbuild:\n  test:\n    extends: x-go\n")
+			g.Assert(err.Error()).Equal(".drone.yml:3: cannot unmarshal !!str `maybe` into bool")
+		})
+	})
+}
+
+var sampleStepError = `
+build:
+  image: golang
+  commands:
+    - go build
+    - go test
+
+publish:
+  # push the image
+  docker:
+    repo: octocat/hello-world
+    tag: latest
+    pull: maybe
+`
+
+var sampleExtendsError = `
+templates:
+  go:
+    image: golang
+    commands: [ go test ]
+
+build:
+  test:
+    extends: go
+    environment:
+      - CGO_ENABLED=0
+    pull: maybe
+`
+
+var samplePositions = `
+clone:
+  depth: 1
+build:
+  backend:
+    image: golang
+    commands: [ go test ]
+  frontend:
+    image: node
+    commands: [ npm test ]
+    when:
+      branch: master
+compose:
+  redis:
+    image: redis
+notify:
+  slack:
+    channel: dev
+`
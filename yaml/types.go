@@ -3,6 +3,14 @@ package yaml
 // Config is a typed representation of the
 // Yaml configuration file.
 type Config struct {
+	Version int
+	Debug   bool
+
+	// Environment and Defaults are merged into every step,
+	// with the settings of the step taking precedence.
+	Environment MapEqualSlice
+	Defaults    Defaults
+
 	Cache Plugin
 	Clone Plugin
 	Build BuildStep
@@ -11,21 +19,40 @@ type Config struct {
 	Publish Pluginslice
 	Deploy  Pluginslice
 	Notify  Pluginslice
+
+	// Pipeline lists the steps of the version 2 Yaml
+	// configuration file, in order.
+	Pipeline Steps
 }
 
 // Container is a typed representation of a
 // docker step in the Yaml configuration file.
 type Container struct {
+	Name        string              `yaml:"-"`
+	Pos         Position            `yaml:"-"` // position of the step
+	Keys        map[string]Position `yaml:"-"` // position of each key
 	Image       string
 	Pull        bool
 	Privileged  bool
 	Environment MapEqualSlice
+	EnvFile     Stringorslice `yaml:"env_file"`
 	Entrypoint  Command
 	Command     Command
 	ExtraHosts  []string `yaml:"extra_hosts"`
 	Volumes     []string
 	Net         string
+	WorkingDir  string `yaml:"working_dir"`
+	User        string
+	Hostname    string
+	DNS         Stringorslice `yaml:"dns"`
+	DNSSearch   Stringorslice `yaml:"dns_search"`
+	Tmpfs       Stringorslice
+	CapAdd      []string `yaml:"cap_add"`
+	CapDrop     []string `yaml:"cap_drop"`
+	Devices     []string
+	Proxy       *bool
 	AuthConfig  AuthConfig `yaml:"auth_config"`
+	Healthcheck *Healthcheck
 }
 
 // Build is a typed representation of the build
@@ -37,6 +64,39 @@ type Build struct {
 	Filter   Filter `yaml:"when"`
 }
 
+// Service is a typed representation of a service in
+// the compose section of the Yaml configuration file.
+type Service struct {
+	Container `yaml:",inline"`
+
+	Filter Filter `yaml:"when"`
+}
+
+// Defaults is a typed representation of the default
+// settings of every step in the Yaml configuration file.
+type Defaults struct {
+	Pull       bool
+	Volumes    []string
+	ExtraHosts []string `yaml:"extra_hosts"`
+	Net        string
+	DNS        Stringorslice `yaml:"dns"`
+	DNSSearch  Stringorslice `yaml:"dns_search"`
+	AuthConfig AuthConfig    `yaml:"auth_config"`
+}
+
+// Step is a typed representation of a step in the
+// pipeline section of the version 2 Yaml configuration
+// file. Every step has a name and a type, and the plugin
+// arguments are declared in the settings section.
+type Step struct {
+	Container `yaml:",inline"`
+
+	Type     string
+	Commands []string
+	Settings Vargs
+	Filter   Filter `yaml:"when"`
+}
+
 // Auth for Docker Image Registry
 type AuthConfig struct {
 	Username      string `yaml:"username"`
@@ -55,6 +115,16 @@ type Plugin struct {
 	Filter Filter `yaml:"when"`
 }
 
+// Cache is a typed representation of the native cache
+// section in the Yaml configuration file, used to restore
+// and save workspace paths without a cache plugin.
+type Cache struct {
+	Key      string
+	Fallback []string `yaml:"fallback_keys"`
+	Paths    []string
+	MaxSize  string `yaml:"max_size"`
+}
+
 // Vargs holds unstructured arguments, specific
 // to the plugin, that are used at runtime when
 // executing the plugin.
@@ -71,4 +141,19 @@ type Filter struct {
 	Failure string
 	Change  string
 	Matrix  map[string]string
+	Expr    string
+	Paths   PathFilter
+
+	Tag         Stringorslice
+	Environment Stringorslice
+
+	Pos Position `yaml:"-"` // position of the when section
+}
+
+// PathFilter is a typed representation of the changed
+// file patterns used to decide if a particular step
+// should be executed or skipped.
+type PathFilter struct {
+	Include Stringorslice
+	Exclude Stringorslice
 }
@@ -2,6 +2,7 @@ package yaml
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/flynn/go-shlex"
@@ -34,6 +35,8 @@ func (s *Command) Slice() []string {
 	return s.parts
 }
 
+// MapEqualSlice is a list of key=value strings, which may be
+// written as a mapping. Mappings are converted in order.
 type MapEqualSlice struct {
 	parts []string
 }
@@ -51,8 +54,16 @@ func (s *MapEqualSlice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
-	for k, v := range mapType {
-		s.parts = append(s.parts, strings.Join([]string{k, v}, "="))
+	// unmarshal the yaml into the generic
+	// mapSlice type to preserve ordering.
+	obj := yaml.MapSlice{}
+	if err := unmarshal(&obj); err != nil {
+		return err
+	}
+
+	for _, item := range obj {
+		k := fmt.Sprint(item.Key)
+		s.parts = append(s.parts, strings.Join([]string{k, mapType[k]}, "="))
 	}
 
 	return nil
@@ -135,6 +146,7 @@ func (s *Pluginslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if len(plugin.Image) == 0 {
 			plugin.Image = key
 		}
+		plugin.Name = key
 		s.parts = append(s.parts, plugin)
 		return nil
 	})
@@ -146,9 +158,11 @@ func (s *Pluginslice) Slice() []Plugin {
 }
 
 // ContainerSlice is a slice of Containers with a custom
-// Yaml unarmshal function to preserve ordering.
+// Yaml unarmshal function to preserve ordering. Services may
+// be imported from a docker-compose file using the file key.
 type Containerslice struct {
-	parts []Container
+	parts []Service
+	file  string
 }
 
 func (s *Containerslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -164,7 +178,10 @@ func (s *Containerslice) UnmarshalYAML(unmarshal func(interface{}) error) error
 	// unarmshals each item in the mapSlice,
 	// unmarshal and append to the slice.
 	return unmarshalYaml(obj, func(key string, val []byte) error {
-		ctr := Container{}
+		if key == "file" && yaml.Unmarshal(val, &s.file) == nil {
+			return nil
+		}
+		ctr := Service{}
 		err := yaml.Unmarshal(val, &ctr)
 		if err != nil {
 			return err
@@ -172,12 +189,13 @@ func (s *Containerslice) UnmarshalYAML(unmarshal func(interface{}) error) error
 		if len(ctr.Image) == 0 {
 			ctr.Image = key
 		}
+		ctr.Name = key
 		s.parts = append(s.parts, ctr)
 		return nil
 	})
 }
 
-func (s *Containerslice) Slice() []Container {
+func (s *Containerslice) Slice() []Service {
 	return s.parts
 }
 
@@ -213,6 +231,7 @@ func (s *BuildStep) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if err != nil {
 			return err
 		}
+		build.Name = key
 		s.parts = append(s.parts, build)
 		return nil
 	})
@@ -243,8 +262,43 @@ func unmarshalYaml(v yaml.MapSlice, emit unmarshal) error {
 		// unmarshal the raw value using the
 		// callback function.
 		if err := emit(key, val); err != nil {
+			return &fragmentError{key: key, frag: val, err: err}
+		}
+	}
+	return nil
+}
+
+// Steps is a list of named steps with a custom Yaml
+// unmarshal function to record the name of each step.
+type Steps struct {
+	parts []Step
+}
+
+func (s *Steps) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []yaml.MapSlice
+	if err := unmarshal(&items); err != nil {
+		return err
+	}
+	for i, item := range items {
+		val, err := yaml.Marshal(item)
+		if err != nil {
 			return err
 		}
+		step := Step{}
+		if err := yaml.Unmarshal(val, &step); err != nil {
+			return &fragmentError{key: strconv.Itoa(i), frag: val, err: err}
+		}
+		if name, ok := lookup(item, "name"); ok && name != nil {
+			step.Name = fmt.Sprint(name)
+		}
+		if len(step.Type) == 0 {
+			step.Type = StepBuild
+		}
+		s.parts = append(s.parts, step)
 	}
 	return nil
 }
+
+func (s *Steps) Slice() []Step {
+	return s.parts
+}
@@ -0,0 +1,101 @@
+package yaml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Versions of the Yaml configuration file. Version 1 declares
+// steps in sections, and is used if no version is specified.
+// Version 2 declares steps in the pipeline section, in order.
+const (
+	Version1 = 1
+	Version2 = 2
+)
+
+// Step types of the version 2 Yaml configuration file.
+const (
+	StepClone   = "clone"
+	StepCache   = "cache"
+	StepService = "service"
+	StepBuild   = "build"
+	StepPublish = "publish"
+	StepDeploy  = "deploy"
+	StepNotify  = "notify"
+)
+
+var stepTypes = []string{
+	StepClone,
+	StepCache,
+	StepService,
+	StepBuild,
+	StepPublish,
+	StepDeploy,
+	StepNotify,
+}
+
+// validate is a helper function that returns an error if
+// the configuration does not match the schema of its version.
+func validate(c *Config) error {
+	switch c.Version {
+	case 0, Version1:
+		if len(c.Pipeline.parts) != 0 {
+			return fmt.Errorf("pipeline section requires version %d", Version2)
+		}
+		return nil
+	case Version2:
+		return validateSteps(c)
+	}
+	return fmt.Errorf("unsupported version %d, expected %d or %d", c.Version, Version1, Version2)
+}
+
+// validateSteps is a helper function that returns an error
+// if the version 2 configuration declares steps outside the
+// pipeline section, or declares invalid steps.
+func validateSteps(c *Config) error {
+	sections := []struct {
+		name  string
+		empty bool
+	}{
+		{"clone", len(c.Clone.marshal()) == 0},
+		{"compose", len(c.Compose.parts) == 0 && len(c.Compose.file) == 0},
+		{"build", len(c.Build.parts) == 0},
+		{"publish", len(c.Publish.parts) == 0},
+		{"deploy", len(c.Deploy.parts) == 0},
+		{"notify", len(c.Notify.parts) == 0},
+	}
+	for _, section := range sections {
+		if !section.empty {
+			return fmt.Errorf("%s section is not supported in version %d, use the pipeline section", section.name, Version2)
+		}
+	}
+	// the cache section configures the native cache.
+	if _, ok := c.Cache.Vargs["paths"]; !ok && len(c.Cache.marshal()) != 0 {
+		return fmt.Errorf("cache plugin is not supported in version %d, use a cache step", Version2)
+	}
+
+	names := map[string]bool{}
+	for i, step := range c.Pipeline.parts {
+		var err error
+		switch {
+		case len(step.Name) == 0:
+			err = fmt.Errorf("pipeline step %d must have a name", i+1)
+		case names[step.Name]:
+			err = fmt.Errorf("duplicate step name %q", step.Name)
+		case !contains(stepTypes, step.Type):
+			err = fmt.Errorf("step %s: invalid type %q, expected one of %s", step.Name, step.Type, strings.Join(stepTypes, ", "))
+		case len(step.Commands) != 0 && step.Type != StepBuild:
+			err = fmt.Errorf("step %s: commands are only supported by build steps", step.Name)
+		case len(step.Settings) != 0 && (step.Type == StepBuild || step.Type == StepService):
+			err = fmt.Errorf("step %s: settings are not supported by %s steps", step.Name, step.Type)
+		}
+		if err != nil && step.Pos.IsValid() {
+			return &Error{Pos: step.Pos, Msg: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		names[step.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestVersion(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Version 2", func() {
+
+		g.It("Should parse the pipeline in order", func() {
+			conf, err := ParseString(sampleVersion2)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Version).Equal(2)
+			steps := conf.Pipeline.Slice()
+			g.Assert(len(steps)).Equal(3)
+			g.Assert(steps[0].Name).Equal("redis")
+			g.Assert(steps[0].Type).Equal("service")
+			g.Assert(steps[1].Name).Equal("test")
+			g.Assert(steps[1].Type).Equal("build")
+			g.Assert(steps[1].Commands).Equal([]string{"go test"})
+			g.Assert(steps[1].Pos.String()).Equal(".drone.yml:6:5")
+			g.Assert(steps[2].Settings["channel"]).Equal("dev")
+			g.Assert(steps[2].Filter.Event.Slice()).Equal([]string{"push"})
+		})
+
+		g.It("Should extend steps from templates", func() {
+			conf, err := ParseString("version: 2\nx-go: { image: golang }\npipeline:\n  - name: test\n    extends: x-go\n")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Pipeline.Slice()[0].Image).Equal("golang")
+		})
+
+		g.It("Should reject invalid steps", func() {
+			for in, msg := range map[string]string{
+				"- image: golang": ".drone.yml:4:3: pipeline step 1 must have a name",
+				"- { name: a, image: golang }\n- { name: a, image: golang }": `.drone.yml:5:3: duplicate step name "a"`,
+				"- { name: a, type: test }":                                  `.drone.yml:4:3: step a: invalid type "test", expected one of clone, cache, service, build, publish, deploy, notify`,
+				"- { name: a, type: notify, commands: [ ls ] }":              ".drone.yml:4:3: step a: commands are only supported by build steps",
+				"- { name: a, settings: { foo: bar } }":                      ".drone.yml:4:3: step a: settings are not supported by build steps",
+			} {
+				_, err := ParseString("\nversion: 2\npipeline:\n" + in)
+				g.Assert(err.Error()).Equal(msg)
+			}
+		})
+
+		g.It("Should reject sections of version 1", func() {
+			_, err := ParseString("version: 2\nbuild: { image: golang }\n")
+			g.Assert(err.Error()).Equal("build section is not supported in version 2, use the pipeline section")
+			_, err = ParseString("version: 2\ncache: { mount: node_modules }\n")
+			g.Assert(err.Error()).Equal("cache plugin is not supported in version 2, use a cache step")
+			_, err = ParseString("version: 2\ncache: { paths: [ node_modules ] }\n")
+			g.Assert(err == nil).IsTrue()
+		})
+
+		g.It("Should require version 2 for the pipeline section", func() {
+			_, err := ParseString("pipeline:\n  - name: test\n")
+			g.Assert(err.Error()).Equal("pipeline section requires version 2")
+			_, err = ParseString("version: 3\n")
+			g.Assert(err.Error()).Equal("unsupported version 3, expected 1 or 2")
+		})
+	})
+}
+
+var sampleVersion2 = `
+version: 2
+pipeline:
+  - name: redis
+    type: service
+  - name: test
+    image: golang
+    commands: [ go test ]
+  - name: slack
+    type: notify
+    image: slack
+    settings:
+      channel: dev
+    when:
+      event: push
+`